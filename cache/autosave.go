@@ -0,0 +1,62 @@
+package cache
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// AutoSave saves the cache every interval if it has been updated (see IsDirty), and saves it a final time when ctx
+// is cancelled or the process receives SIGINT or SIGTERM. If interval is not positive the cache is only saved a final
+// time. Save errors are passed to onError if it is not nil.
+// AutoSave returns after the final save. If the final save was triggered by a signal then the signal is re-raised
+// so the process terminates as it would have done without AutoSave.
+func (c *Cache[T]) AutoSave(ctx context.Context, interval time.Duration, onError func(error)) {
+	save := func() {
+		if err := c.Save(); err != nil && onError != nil {
+			onError(err)
+		}
+	}
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+	autoSaveListening()
+	var tick <-chan time.Time // Nil, and never ready, if there are no periodic saves.
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-tick:
+			if c.IsDirty() {
+				save()
+			}
+		case <-ctx.Done():
+			save()
+			return
+		case sig := <-sigs:
+			save()
+			signal.Stop(sigs)
+			reraise(sig)
+			return
+		}
+	}
+}
+
+// autoSaveListening is called once AutoSave is receiving signals, tests replace it to send signals.
+var autoSaveListening = func() {}
+
+// reraise sends sig to the current process, exiting if that is not supported on this platform.
+func reraise(sig os.Signal) {
+	p, err := os.FindProcess(os.Getpid())
+	if err == nil {
+		err = p.Signal(sig)
+	}
+	if err != nil {
+		os.Exit(1)
+	}
+}
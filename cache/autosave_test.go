@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/srackham/go-utils/assert"
+)
+
+func TestAutoSave(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "counter.json")
+	var data Counter
+	c := New(&data)
+	c.CacheFile = file
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.AutoSave(ctx, 5*time.Millisecond, func(err error) { t.Errorf("unexpected save error: %v", err) })
+		close(done)
+	}()
+
+	saved := func() int {
+		var data Counter
+		c := New(&data)
+		c.CacheFile = file
+		c.Load()
+		return data.Count
+	}
+	// Updates are saved periodically.
+	c.Update(func(data *Counter) error {
+		data.Count = 1
+		return nil
+	})
+	deadline := time.Now().Add(5 * time.Second)
+	for saved() != 1 {
+		assert.PassIf(t, time.Now().Before(deadline), "cache was not saved")
+		time.Sleep(time.Millisecond)
+	}
+
+	// A final save is made when the context is cancelled.
+	c.Update(func(data *Counter) error {
+		data.Count = 2
+		return nil
+	})
+	cancel()
+	<-done
+	assert.Equal(t, 2, saved())
+}
+
+func TestAutoSaveError(t *testing.T) {
+	var data Counter
+	c := New(&data)
+	c.CacheFile = filepath.Join(t.TempDir(), "missing", "counter.json")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var saveErr error
+	c.AutoSave(ctx, time.Hour, func(err error) { saveErr = err })
+	assert.PassIf(t, saveErr != nil, "expected save error")
+}
+
+func TestAutoSaveNoInterval(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "counter.json")
+	var data Counter
+	c := New(&data)
+	c.CacheFile = file
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.AutoSave(ctx, 0, func(err error) { t.Errorf("unexpected save error: %v", err) })
+		close(done)
+	}()
+	c.Update(func(data *Counter) error {
+		data.Count = 1
+		return nil
+	})
+	time.Sleep(20 * time.Millisecond)
+	assert.False(t, c.Exists()) // No periodic saves.
+	cancel()
+	<-done
+	assert.True(t, c.Exists())
+}
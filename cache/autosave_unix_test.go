@@ -0,0 +1,49 @@
+//go:build unix
+
+package cache
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/srackham/go-utils/assert"
+)
+
+func TestAutoSaveSignal(t *testing.T) {
+	if file := os.Getenv("AUTOSAVE_TEST_FILE"); file != "" {
+		// Child process: update the cache and then terminate with SIGTERM before the first periodic save.
+		var data Counter
+		c := New(&data)
+		c.CacheFile = file
+		c.Update(func(data *Counter) error {
+			data.Count = 42
+			return nil
+		})
+		autoSaveListening = func() {
+			syscall.Kill(os.Getpid(), syscall.SIGTERM)
+		}
+		c.AutoSave(context.Background(), time.Hour, nil)
+		time.Sleep(5 * time.Second) // The re-raised signal terminates the process.
+		os.Exit(0)
+	}
+	file := filepath.Join(t.TempDir(), "counter.json")
+	cmd := exec.Command(os.Args[0], "-test.run=^TestAutoSaveSignal$")
+	cmd.Env = append(os.Environ(), "AUTOSAVE_TEST_FILE="+file)
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	assert.PassIf(t, errors.As(err, &exitErr), "expected process to be terminated: %v", err)
+	status, ok := exitErr.Sys().(syscall.WaitStatus)
+	assert.PassIf(t, ok && status.Signaled() && status.Signal() == syscall.SIGTERM, "unexpected exit status: %v", err)
+	var data Counter
+	c := New(&data)
+	c.CacheFile = file
+	err = c.Load()
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.Equal(t, 42, data.Count)
+}
@@ -0,0 +1,92 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/srackham/go-utils/fsx"
+)
+
+// BackupPath returns the path of cache file backup generation (1 is the most recent).
+func (c *Cache[T]) BackupPath(generation int) string {
+	return fmt.Sprintf("%s.%d", c.CacheFile, generation)
+}
+
+// Restore replaces the cache file with backup generation and then loads it. The backup is decoded before the cache
+// file is replaced, if it cannot be decoded the cache file is left unchanged and the decoding error is returned. The
+// current cache file is rotated into the backups, as it is by Save, so backup generations are renumbered and at least
+// generation generations are kept.
+func (c *Cache[T]) Restore(generation int) error {
+	if c.CacheFile == "" {
+		return ErrNoCacheFile
+	}
+	backup, err := os.ReadFile(c.BackupPath(generation))
+	if err != nil {
+		return err
+	}
+	if err := c.validate(backup); err != nil {
+		var corruptErr *CorruptError
+		if errors.As(err, &corruptErr) {
+			corruptErr.Path = c.BackupPath(generation)
+		}
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	unlock, err := c.lockIfUnlocked(context.Background())
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := c.rotateBackups(max(c.Backups, generation)); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(c.CacheFile, backup); err != nil {
+		return err
+	}
+	// The journal records changes to the replaced cache file.
+	if err := os.Remove(c.JournalPath()); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return c.loadFile(context.Background(), true)
+}
+
+// validate returns an error if cache file contents cannot be decoded into the cache data.
+func (c *Cache[T]) validate(file []byte) error {
+	env, data, err := c.decode(file)
+	if err != nil {
+		return err
+	}
+	migrated, err := c.migrate(env, data)
+	if err != nil {
+		return err
+	}
+	if err := c.codec().Unmarshal(migrated, new(T)); err != nil {
+		return &CorruptError{Err: err}
+	}
+	return nil
+}
+
+// rotateBackups renumbers existing backup generations, keeping at most n, and makes the current cache file backup
+// generation 1.
+func (c *Cache[T]) rotateBackups(n int) error {
+	if n <= 0 || !fsx.FileExists(c.CacheFile) {
+		return nil
+	}
+	if err := os.Remove(c.BackupPath(n)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	for g := n - 1; g >= 1; g-- {
+		if err := os.Rename(c.BackupPath(g), c.BackupPath(g+1)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	// The cache file is replaced by renaming so a hard link preserves its current contents.
+	if err := os.Link(c.CacheFile, c.BackupPath(1)); err != nil {
+		return fsx.CopyFile(c.CacheFile, c.BackupPath(1))
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package cache
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/srackham/go-utils/assert"
+	"github.com/srackham/go-utils/fsx"
+)
+
+func TestBackups(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "counter.json")
+	var data Counter
+	c := New(&data)
+	c.CacheFile = file
+	c.Backups = 2
+	for i := 1; i <= 4; i++ {
+		data.Count = i
+		err := c.Save()
+		assert.PassIf(t, err == nil, "%v", err)
+	}
+	// Unchanged data does not rotate the backups.
+	err := c.Save()
+	assert.PassIf(t, err == nil, "%v", err)
+
+	count := func(file string) int {
+		t.Helper()
+		var data Counter
+		c := New(&data)
+		c.CacheFile = file
+		err := c.Load()
+		assert.PassIf(t, err == nil, "%v", err)
+		return data.Count
+	}
+	assert.Equal(t, 4, count(file))
+	assert.Equal(t, 3, count(c.BackupPath(1)))
+	assert.Equal(t, 2, count(c.BackupPath(2)))
+	assert.False(t, fsx.FileExists(c.BackupPath(3)))
+
+	// Restore a backup generation, the current cache file becomes backup generation 1.
+	err = c.Restore(1)
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.Equal(t, 3, data.Count)
+	assert.Equal(t, 3, count(file))
+	assert.Equal(t, 4, count(c.BackupPath(1)))
+	assert.Equal(t, 3, count(c.BackupPath(2)))
+	err = c.Restore(3)
+	assert.PassIf(t, err != nil, "expected missing backup error")
+
+	// Load falls back to the most recent backup that can be decoded.
+	err = os.WriteFile(file, []byte(`{"Count": 5`), 0644)
+	assert.PassIf(t, err == nil, "%v", err)
+	err = os.WriteFile(c.BackupPath(1), []byte(`garbage`), 0644)
+	assert.PassIf(t, err == nil, "%v", err)
+	data.Count = 0
+	err = c.Load()
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.Equal(t, 3, data.Count)
+	// The next Save replaces the corrupt cache file.
+	err = c.Save()
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.Equal(t, 3, count(file))
+	assert.Equal(t, 5, fsx.DirCount(filepath.Dir(file))) // Cache file, two backups, lock file and corrupt file.
+	corrupt, _ := filepath.Glob(file + ".corrupt-*")
+	assert.Equal(t, 1, len(corrupt))
+
+	// Without backups the decode error is returned and the cache data is unchanged.
+	err = os.WriteFile(file, []byte(`{"Count": 5`), 0644)
+	assert.PassIf(t, err == nil, "%v", err)
+	c.Backups = 0
+	err = c.Load()
+	assert.PassIf(t, err != nil, "expected decode error")
+	assert.Equal(t, 3, data.Count)
+}
+
+func TestRestoreCorrupt(t *testing.T) {
+	for _, locked := range []bool{false, true} {
+		file := filepath.Join(t.TempDir(), "counter.json")
+		var data Counter
+		c := New(&data)
+		c.CacheFile = file
+		c.Backups = 2
+		c.LockTimeout = 5 * time.Second
+		for i := 1; i <= 3; i++ {
+			data.Count = i
+			err := c.Save()
+			assert.PassIf(t, err == nil, "%v", err)
+		}
+		err := os.WriteFile(c.BackupPath(1), []byte(`garbage`), 0644)
+		assert.PassIf(t, err == nil, "%v", err)
+		if locked {
+			err = c.LoadLocked()
+			assert.PassIf(t, err == nil, "%v", err)
+		}
+		done := make(chan error)
+		go func() { done <- c.Restore(1) }()
+		select {
+		case err = <-done:
+		case <-time.After(time.Second):
+			t.Fatalf("Restore did not return (locked: %v)", locked)
+		}
+		var corruptErr *CorruptError
+		assert.PassIf(t, errors.As(err, &corruptErr), "expected CorruptError: %v", err)
+		assert.Equal(t, c.BackupPath(1), corruptErr.Path)
+		// The cache file and the cache data are unchanged.
+		assert.Equal(t, 3, data.Count)
+		var disk Counter
+		c2 := New(&disk)
+		c2.CacheFile = file
+		err = c2.Load()
+		assert.PassIf(t, err == nil, "%v", err)
+		assert.Equal(t, 3, disk.Count)
+
+		// Restoring a good generation while the lock is held.
+		err = c.Restore(2)
+		assert.PassIf(t, err == nil, "%v", err)
+		assert.Equal(t, 1, data.Count)
+		assert.False(t, c.IsDirty())
+		c.Unlock()
+	}
+}
@@ -1,18 +1,65 @@
 package cache
 
 import (
+	"context"
 	"crypto/sha256"
-	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
 
 	"github.com/srackham/go-utils/fsx"
+	"github.com/srackham/go-utils/helpers"
 )
 
+// ErrNoCacheFile is returned when Cache.CacheFile has not been set.
+var ErrNoCacheFile = errors.New("cache: uninitialised Cache.CacheFile")
+
+// ErrConflict is returned by Save when the cache file has been modified by another process since it was loaded.
+var ErrConflict = errors.New("cache: cache file modified by another process")
+
 // Cache is designed to be embedded, it implements file-based data persistance with load and save functions.
 // The cache data is external to the Cache struct and is accessed via the CacheData pointer.
+//
+// Save holds an advisory lock on a sibling lock file (see LockPath) while it writes the cache file. Use LoadLocked and
+// Unlock, or WithLock, to hold the lock across a load-modify-save cycle so concurrent processes cannot clobber each
+// other's changes.
+//
+// Goroutines that share a Cache should access the cache data with Read and Update, which are synchronized with Load,
+// Save and Watch reloads. While one goroutine holds the lock acquired by LoadLocked other goroutines' saves use it.
 type Cache[T any] struct {
-	CacheData *T
-	CacheFile string
-	sha256    [32]byte // Cache file checksum.
+	CacheData     *T
+	CacheFile     string
+	Codec         Codec                           // Cache file encoding (defaults to JSON).
+	Compress      bool                            // Gzip compress the cache file.
+	Checksum      bool                            // Append a checksum trailer, which Load verifies, to the cache file.
+	Key           []byte                          // AES key (16, 24 or 32 bytes), the cache file is encrypted if set.
+	Journal       bool                            // Save appends changes to a journal file (see Save and Compact).
+	TTL           time.Duration                   // Time after which saved cache data expires (zero never expires).
+	ResetExpired  bool                            // Load resets expired cache data to its zero value instead of returning ErrExpired.
+	Backups       int                             // Number of previous cache file generations kept by Save.
+	Version       int                             // Cache data schema version, saved in the cache file.
+	Migrations    map[int]Migration               // Migrations[v] converts version v cache data to version v+1.
+	LockTimeout   time.Duration                   // Maximum time to wait for the cache file lock (defaults to DefaultLockTimeout).
+	Merge         func(onDisk, inMemory *T) error // Merges another process's changes into inMemory (see Save).
+	WatchInterval time.Duration                   // Watch polling interval (defaults to DefaultWatchInterval).
+	MaxSize       int64                           // Maximum cache file size, and decompressed size, Load accepts (zero is unlimited).
+	Progress      func(read, size int64)          // Called as Load reads the cache file.
+	mu            sync.RWMutex                    // Guards CacheData and the cache state.
+	dirty         bool                            // Set by Update, cleared by Load and Save.
+	sha256        [32]byte                        // Cache data checksum (encoded, uncompressed).
+	fileSHA256    [32]byte                        // Cache file checksum.
+	synced        bool                            // The cache file has been loaded or saved, Save checks for conflicts.
+	lockMu        sync.Mutex                      // Guards lockFile.
+	lockFile      *os.File                        // Cache file lock held by LoadLocked.
+	journalBase   []byte                          // Encoded cache data the next journal record is relative to.
+	journalSize   int64                           // Journal file size when it was last loaded or saved.
+	lastSaved     time.Time                       // Time the cache data was last saved.
+	lastLoaded    time.Time                       // Time the cache data was last loaded.
 }
 
 func New[T any](data *T) *Cache[T] {
@@ -21,35 +68,505 @@ func New[T any](data *T) *Cache[T] {
 	}
 }
 
+// NewForApp returns a Cache whose CacheFile is named name in the appName subdirectory of the user's cache directory
+// (see helpers.GetCacheDir). The Codec is chosen from name's extension, ".json" selects JSON and ".gob" selects Gob,
+// and an error is returned for other extensions. If name has no extension the JSON codec's extension is appended to
+// it. Missing directories are created.
+func NewForApp[T any](appName, name string, data *T) (*Cache[T], error) {
+	if appName == "" || name == "" {
+		return nil, errors.New("cache: missing application or cache name")
+	}
+	root := helpers.GetCacheDir()
+	if root == "" {
+		return nil, errors.New("cache: cannot determine user cache directory")
+	}
+	if filepath.Ext(name) == "" {
+		name += JSON.Ext()
+	}
+	var codec Codec
+	for _, cc := range []Codec{JSON, Gob} {
+		if filepath.Ext(name) == cc.Ext() {
+			codec = cc
+		}
+	}
+	if codec == nil {
+		return nil, fmt.Errorf("cache: no codec for cache file name extension: %q", filepath.Ext(name))
+	}
+	c := New(data)
+	c.Codec = codec
+	c.CacheFile = filepath.Join(root, appName, name)
+	if err := fsx.MkMissingDir(filepath.Dir(c.CacheFile)); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Load reads the cache file into the cache data. Compressed cache files are detected and decompressed automatically.
+//
+// If the cache data was saved with a TTL that has since elapsed then Load returns ErrExpired and the cache data is not
+// loaded, or, if ResetExpired is set, the cache data is reset to its zero value. Expired data is always rewritten by
+// the next Save.
+//
+// Cache data saved with an older schema Version is migrated to the current version by running the registered
+// Migrations in sequence, migrated data is always rewritten by the next Save. A *VersionError is returned if the cache
+// file's schema version is newer than Version.
+//
+// If the cache file cannot be decoded, or its checksum trailer does not match, then the cache data is left unchanged,
+// the cache file is renamed to <CacheFile>.corrupt-<timestamp> and a *CorruptError is returned. If Backups is set then
+// the most recent backup generation that can be decoded is loaded instead and no error is returned.
+//
+// Encrypted cache files are decrypted with Key, ErrDecrypt is returned if decryption fails. Unencrypted cache files
+// can be loaded when Key is set and are encrypted by the next Save.
+//
+// ErrTooLarge is returned if MaxSize is set and the cache file, or its decompressed contents, is larger than MaxSize.
+// JSON cache files that are not encrypted, have no checksum trailer and no journal are decoded as they are read,
+// other cache files are read into memory before they are decoded.
 func (c *Cache[T]) Load() error {
+	return c.LoadContext(context.Background())
+}
+
+// LoadContext is like Load but stops reading the cache file, leaves the cache data unchanged and returns ctx.Err()
+// if ctx is cancelled.
+func (c *Cache[T]) LoadContext(ctx context.Context) error {
 	if c.CacheFile == "" {
-		panic("uninitialised Cache.CacheFile")
+		return ErrNoCacheFile
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.loadFile(ctx, false)
+}
+
+// loadFile loads the cache file, the caller must hold the mutex. locked is true if the caller holds the cache file
+// lock.
+func (c *Cache[T]) loadFile(ctx context.Context, locked bool) error {
+	c.synced = true
+	if !fsx.FileExists(c.CacheFile) {
+		return nil
 	}
-	var err error
-	if fsx.FileExists(c.CacheFile) {
-		s, err := fsx.ReadFile(c.CacheFile)
-		if err == nil {
-			err = json.Unmarshal([]byte(s), c.CacheData)
-			if err == nil {
-				c.sha256 = sha256.Sum256([]byte(s))
-			}
+	f, info, err := c.openFile(c.CacheFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	size := info.Size()
+	if c.canStream(f, size) {
+		err := c.loadStream(c.newFileReader(ctx, f, size), info.ModTime())
+		var corruptErr *CorruptError
+		if !errors.Is(err, errNoStream) && !errors.As(err, &corruptErr) {
+			return err
+		}
+		// Read the whole file so corrupt files can be quarantined and migrations applied.
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
 		}
 	}
-	return err
+	file, err := c.readAll(ctx, f, size)
+	if err != nil {
+		return err
+	}
+	j, err := readJournal(c.JournalPath(), sha256.Sum256(file))
+	if err != nil {
+		return err
+	}
+	c.journalSize = j.size
+	err = c.load(file, info.ModTime(), j.records)
+	var corruptErr *CorruptError
+	if !errors.As(err, &corruptErr) {
+		return err
+	}
+	corruptErr.Path = c.CacheFile
+	corruptErr.MovedTo = c.quarantine(file, locked)
+	// Ensure the next Save replaces the corrupt cache file.
+	fileSHA := [32]byte{}
+	if corruptErr.MovedTo == "" {
+		fileSHA = sha256.Sum256(file)
+	} else {
+		c.journalSize = 0
+	}
+	c.sha256 = [32]byte{}
+	c.fileSHA256 = fileSHA
+	// Fall back to the most recent backup generation that can be decoded.
+	for g := 1; g <= c.Backups; g++ {
+		backup, err := c.readFile(ctx, c.BackupPath(g))
+		if err != nil {
+			continue
+		}
+		if info, err := os.Stat(c.BackupPath(g)); err == nil && c.load(backup, info.ModTime(), nil) == nil {
+			c.sha256 = [32]byte{}
+			c.fileSHA256 = fileSHA
+			return nil
+		}
+	}
+	return corruptErr
+}
+
+// load decodes cache file contents, and applies journal records, into the cache data. The cache data is not modified
+// if decoding fails. modTime is the cache file modification time.
+func (c *Cache[T]) load(file []byte, modTime time.Time, journal [][]byte) error {
+	env, data, err := c.decode(file)
+	if err != nil {
+		return err
+	}
+	if len(journal) > 0 {
+		if data, err = applyJournal(data, journal); err != nil {
+			return &CorruptError{Err: err}
+		}
+	}
+	c.journalBase = nil
+	migrated, err := c.migrate(env, data)
+	if err != nil {
+		return err
+	}
+	if env.expired() {
+		c.sha256 = [32]byte{}
+		c.fileSHA256 = sha256.Sum256(file)
+		if !c.ResetExpired {
+			return ErrExpired
+		}
+		var zero T
+		*c.CacheData = zero
+		c.setLoaded(env, modTime)
+		return nil
+	}
+	v := new(T)
+	if err := c.codec().Unmarshal(migrated, v); err != nil {
+		return &CorruptError{Err: err}
+	}
+	*c.CacheData = *v
+	c.dirty = false
+	c.sha256 = [32]byte{}
+	if env.Version == c.Version && (len(c.Key) == 0 || isEncrypted(file)) && len(journal) == 0 {
+		c.sha256 = sha256.Sum256(data)
+	}
+	if c.Journal && env.Version == c.Version {
+		c.journalBase = data
+	}
+	c.fileSHA256 = sha256.Sum256(file)
+	c.setLoaded(env, modTime)
+	if info, err := os.Stat(c.JournalPath()); err == nil && len(journal) > 0 {
+		c.lastSaved = info.ModTime() // The journal was appended by the last save.
+	}
+	return nil
+}
+
+// setLoaded records the load time and the time the loaded cache data was saved, which is taken from the envelope if
+// it has one, otherwise from the cache file modification time.
+func (c *Cache[T]) setLoaded(env envelope, modTime time.Time) {
+	c.lastLoaded = time.Now()
+	c.lastSaved = env.SavedAt.Local()
+	if env.SavedAt.IsZero() {
+		c.lastSaved = modTime
+	}
 }
 
-// Save writes the cache to disk if it has been modified.
+// Save writes the cache to disk if it has been modified. Modification is detected by comparing checksums of the
+// encoded cache data, so changing the Compress option alone does not rewrite the cache file.
+// The cache file is replaced atomically so an interrupted Save never leaves a partially written cache file.
+//
+// If the cache file has been modified by another process since it was last loaded or saved then Save returns
+// ErrConflict, unless a Merge function has been set in which case the merged data is saved. A Cache that has not been
+// loaded or saved does not check for conflicts, its first Save overwrites an existing cache file.
+//
+// If Backups is set then the previous cache file is kept as backup generation 1 (see BackupPath) and older
+// generations are renumbered, only the most recent Backups generations are kept.
+//
+// If Journal is set then, once the cache file exists, Save appends a JSON merge patch (RFC 7386) record of the
+// changes to the journal file (see JournalPath) instead of rewriting the cache file. Load applies the journal to the
+// cache file and Compact rewrites the cache file and removes the journal. Journal mode requires a JSON Codec, does
+// not support encryption or TTL and cannot represent JSON null object members (they are deleted).
 func (c *Cache[T]) Save() error {
+	return c.SaveContext(context.Background())
+}
+
+// SaveContext is like Save but returns ctx.Err() if ctx is cancelled before the cache file is written, cancellation
+// also stops waiting for the cache file lock. Writing is not interrupted so the cache file is never partially updated.
+func (c *Cache[T]) SaveContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	if c.CacheFile == "" {
-		panic("uninitialised Cache.CacheFile")
+		return ErrNoCacheFile
 	}
-	json, err := json.MarshalIndent(*c.CacheData, "", "  ")
-	if err == nil {
-		sha := sha256.Sum256(json)
-		if c.sha256 != sha {
-			err = fsx.WriteFile(c.CacheFile, string(json))
+	if c.Journal {
+		if err := c.checkJournal(); err != nil {
+			return err
 		}
-		c.sha256 = sha
 	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data, err := c.marshal()
+	if err != nil {
+		return err
+	}
+	sha := sha256.Sum256(data)
+	if c.sha256 == sha {
+		c.dirty = false
+		return nil
+	}
+	unlock, err := c.lockIfUnlocked(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if c.synced {
+		if data, err = c.checkConflict(ctx, data); err != nil {
+			return err
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if c.Journal && c.journalBase != nil && fsx.FileExists(c.CacheFile) {
+		return c.appendJournal(data)
+	}
+	return c.writeFile(data)
+}
+
+// writeFile writes encoded cache data to the cache file and removes the journal file. The caller must hold the mutex
+// and the cache file lock.
+func (c *Cache[T]) writeFile(data []byte) error {
+	file, err := c.encode(data)
+	if err != nil {
+		return err
+	}
+	if err := c.rotateBackups(c.Backups); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(c.CacheFile, file); err != nil {
+		return err
+	}
+	if err := os.Remove(c.JournalPath()); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	c.sha256 = sha256.Sum256(data)
+	c.fileSHA256 = sha256.Sum256(file)
+	c.journalSize = 0
+	c.journalBase = nil
+	if c.Journal {
+		c.journalBase = data
+	}
+	c.dirty = false
+	c.synced = true
+	c.lastSaved = time.Now()
+	return nil
+}
+
+// Read calls f with the cache data, f must not modify the data. Concurrent Read calls are allowed but f must not call
+// other Cache methods.
+func (c *Cache[T]) Read(f func(data *T)) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	f(c.CacheData)
+}
+
+// Update calls f to modify the cache data and, if f succeeds, marks the cache as dirty. f must not call other Cache
+// methods.
+func (c *Cache[T]) Update(f func(data *T) error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := f(c.CacheData); err != nil {
+		return err
+	}
+	c.dirty = true
+	return nil
+}
+
+// IsDirty returns true if the cache has been updated since it was last loaded or saved, or if the cache data differs
+// from the cache data that was last loaded or saved (the cache data is encoded and checksummed, nothing is written).
+// IsDirty returns true if the cache data has not been loaded or saved or cannot be encoded.
+func (c *Cache[T]) IsDirty() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.isDirty()
+}
+
+// isDirty implements IsDirty, the caller must hold the mutex.
+func (c *Cache[T]) isDirty() bool {
+	if c.dirty {
+		return true
+	}
+	data, err := c.marshal()
+	return err != nil || sha256.Sum256(data) != c.sha256
+}
+
+// Exists returns true if the cache file exists.
+func (c *Cache[T]) Exists() bool {
+	return c.CacheFile != "" && fsx.FileExists(c.CacheFile)
+}
+
+// Delete removes the cache file and its journal, backup generations are kept. The cache data is not changed and is
+// written by the next Save. It is not an error if the cache file does not exist.
+func (c *Cache[T]) Delete() error {
+	if c.CacheFile == "" {
+		return ErrNoCacheFile
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	unlock, err := c.lockIfUnlocked(context.Background())
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	for _, name := range []string{c.CacheFile, c.JournalPath()} {
+		if err := os.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	c.sha256 = [32]byte{}
+	c.fileSHA256 = [32]byte{}
+	c.journalBase = nil
+	c.journalSize = 0
+	return nil
+}
+
+// Reset sets the cache data to its zero value and marks the cache as dirty, the cache file is not changed.
+func (c *Cache[T]) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var zero T
+	*c.CacheData = zero
+	c.dirty = true
+}
+
+// LastSaved returns the time the cache data was last saved, by this or (if it was loaded) another process. It
+// returns the zero time if the cache has not been loaded or saved.
+func (c *Cache[T]) LastSaved() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.lastSaved
+}
+
+// LastLoaded returns the time the cache data was last loaded, or the zero time if it has not been loaded.
+func (c *Cache[T]) LastLoaded() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.lastLoaded
+}
+
+func (c *Cache[T]) codec() Codec {
+	if c.Codec == nil {
+		return JSON
+	}
+	return c.Codec
+}
+
+func (c *Cache[T]) marshal() ([]byte, error) {
+	return c.codec().Marshal(*c.CacheData)
+}
+
+// encode converts encoded cache data to cache file contents.
+func (c *Cache[T]) encode(data []byte) (result []byte, err error) {
+	result = data
+	if c.TTL > 0 || c.Version > 0 {
+		env := envelope{SavedAt: time.Now().UTC(), TTL: c.TTL, Version: c.Version}
+		if result, err = env.wrap(result); err != nil {
+			return nil, err
+		}
+	}
+	if c.Compress {
+		if result, err = compress(result); err != nil {
+			return nil, err
+		}
+	}
+	if len(c.Key) > 0 {
+		if result, err = encrypt(c.Key, result); err != nil {
+			return nil, err
+		}
+	}
+	if c.Checksum {
+		result = addChecksum(result)
+	}
+	return result, nil
+}
+
+// decode converts cache file contents to the file's envelope and encoded cache data. Decoding errors are returned as
+// a *CorruptError.
+func (c *Cache[T]) decode(file []byte) (envelope, []byte, error) {
+	data, err := verifyChecksum(file)
+	if err != nil {
+		return envelope{}, nil, &CorruptError{Err: err}
+	}
+	if isEncrypted(data) {
+		// Decryption errors are not treated as corruption because they are usually caused by the wrong key.
+		if data, err = decrypt(c.Key, data); err != nil {
+			return envelope{}, nil, err
+		}
+	}
+	if isCompressed(data) {
+		if data, err = decompress(data, c.MaxSize); errors.Is(err, ErrTooLarge) {
+			return envelope{}, nil, err
+		} else if err != nil {
+			return envelope{}, nil, &CorruptError{Err: err}
+		}
+	}
+	env, data, err := unwrap(data)
+	if err != nil {
+		return envelope{}, nil, &CorruptError{Err: err}
+	}
+	return env, data, nil
+}
+
+// checkConflict returns ErrConflict if the cache file, or its journal, has been modified by another process since it
+// was last loaded or saved. If a Merge function has been set it is called instead and the merged cache data is
+// returned.
+func (c *Cache[T]) checkConflict(ctx context.Context, data []byte) ([]byte, error) {
+	disk, err := c.readFile(ctx, c.CacheFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return data, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	fileSHA := sha256.Sum256(disk)
+	j, err := readJournal(c.JournalPath(), fileSHA)
+	if err != nil {
+		return nil, err
+	}
+	if fileSHA == c.fileSHA256 && j.size == c.journalSize {
+		return data, nil
+	}
+	if c.Merge == nil {
+		return nil, ErrConflict
+	}
+	env, disk, err := c.decode(disk)
+	if err != nil {
+		return nil, err
+	}
+	if len(j.records) > 0 {
+		if disk, err = applyJournal(disk, j.records); err != nil {
+			return nil, err
+		}
+	}
+	migrated, err := c.migrate(env, disk)
+	if err != nil {
+		return nil, err
+	}
+	onDisk := new(T)
+	if err := c.codec().Unmarshal(migrated, onDisk); err != nil {
+		return nil, err
+	}
+	if err := c.Merge(onDisk, c.CacheData); err != nil {
+		return nil, err
+	}
+	// Subsequent conflicts and journal records are relative to the merged on-disk state.
+	c.fileSHA256 = fileSHA
+	c.journalSize = j.size
+	c.journalBase = nil
+	if c.Journal && env.Version == c.Version {
+		c.journalBase = disk
+	}
+	return c.marshal()
+}
+
+// writeData writes data to the temporary file, tests replace it to simulate interrupted writes.
+var writeData = func(f *os.File, data []byte) error {
+	_, err := f.Write(data)
 	return err
 }
+
+// writeFileAtomic atomically replaces file name with data (see fsx.AtomicWriteFile).
+func writeFileAtomic(name string, data []byte) error {
+	return fsx.WriteFileFunc(name, fsx.WriteOptions{Atomic: true}, func(f *os.File) error {
+		return writeData(f, data)
+	})
+}
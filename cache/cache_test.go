@@ -2,10 +2,14 @@ package cache
 
 import (
 	"crypto/sha256"
+	"errors"
 	"os"
 	"path/filepath"
 	"reflect"
+	"runtime"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/srackham/go-utils/assert"
 	"github.com/srackham/go-utils/fsx"
@@ -52,3 +56,329 @@ func TestRates(t *testing.T) {
 	assert.PassIf(t, err == nil, "%v", err)
 	assert.Equal(t, sha, r.sha256)
 }
+
+func TestInterruptedSave(t *testing.T) {
+	data := make(RatesCache)
+	r := New(&data)
+	tmpdir := t.TempDir()
+	r.CacheFile = filepath.Join(tmpdir, "valuations.json")
+	(*r.CacheData)["2022-06-01"] = Rates{"USD": 1.00}
+	err := r.Save()
+	assert.PassIf(t, err == nil, "%v", err)
+	saved, err := fsx.ReadFile(r.CacheFile)
+	assert.PassIf(t, err == nil, "%v", err)
+
+	// Simulate a crash half way through writing the new cache file.
+	writeData = func(f *os.File, data []byte) error {
+		f.Write(data[:len(data)/2])
+		return errors.New("disk full")
+	}
+	defer func() {
+		writeData = func(f *os.File, data []byte) error {
+			_, err := f.Write(data)
+			return err
+		}
+	}()
+	(*r.CacheData)["2022-06-02"] = Rates{"USD": 2.00}
+	err = r.Save()
+	assert.PassIf(t, err != nil, "expected interrupted save error")
+	tmpfiles, _ := filepath.Glob(r.CacheFile + ".tmp-*")
+	assert.Equal(t, 0, len(tmpfiles)) // The temporary file has been removed.
+	s, err := fsx.ReadFile(r.CacheFile)
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.EqualStrings(t, saved, s)
+
+	// A temporary file left behind by a killed process does not affect the cache file.
+	err = fsx.WriteFile(r.CacheFile+".tmp-123", saved[:len(saved)/2])
+	assert.PassIf(t, err == nil, "%v", err)
+
+	data2 := make(RatesCache)
+	r2 := New(&data2)
+	r2.CacheFile = r.CacheFile
+	err = r2.Load()
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.Equal(t, 1, len(data2))
+	assert.Equal(t, 1.00, data2["2022-06-01"]["USD"])
+
+	// The failed save did not update the checksum so a retry writes the file.
+	writeData = func(f *os.File, data []byte) error {
+		_, err := f.Write(data)
+		return err
+	}
+	err = r.Save()
+	assert.PassIf(t, err == nil, "%v", err)
+	err = r2.Load()
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.Equal(t, 2.00, data2["2022-06-02"]["USD"])
+}
+
+func TestSavePreservesMode(t *testing.T) {
+	data := make(RatesCache)
+	r := New(&data)
+	r.CacheFile = filepath.Join(t.TempDir(), "valuations.json")
+	err := r.Save()
+	assert.PassIf(t, err == nil, "%v", err)
+	info, err := os.Stat(r.CacheFile)
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+
+	err = os.Chmod(r.CacheFile, 0600)
+	assert.PassIf(t, err == nil, "%v", err)
+	(*r.CacheData)["2022-06-01"] = Rates{"USD": 1.00}
+	err = r.Save()
+	assert.PassIf(t, err == nil, "%v", err)
+	info, err = os.Stat(r.CacheFile)
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
+
+func TestConflict(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "valuations.json")
+	data1 := make(RatesCache)
+	c1 := New(&data1)
+	c1.CacheFile = file
+	data1["2022-06-01"] = Rates{"USD": 1.00}
+	err := c1.Save()
+	assert.PassIf(t, err == nil, "%v", err)
+
+	data2 := make(RatesCache)
+	c2 := New(&data2)
+	c2.CacheFile = file
+	err = c2.Load()
+	assert.PassIf(t, err == nil, "%v", err)
+	data2["2022-06-02"] = Rates{"USD": 2.00}
+	err = c2.Save()
+	assert.PassIf(t, err == nil, "%v", err)
+	saved, _ := fsx.ReadFile(file)
+
+	// c1 has not seen c2's changes.
+	data1["2022-06-03"] = Rates{"USD": 3.00}
+	err = c1.Save()
+	assert.PassIf(t, errors.Is(err, ErrConflict), "expected ErrConflict: %v", err)
+	s, _ := fsx.ReadFile(file)
+	assert.EqualStrings(t, saved, s)
+
+	c1.Merge = func(onDisk, inMemory *RatesCache) error {
+		for k, v := range *onDisk {
+			if _, ok := (*inMemory)[k]; !ok {
+				(*inMemory)[k] = v
+			}
+		}
+		return nil
+	}
+	err = c1.Save()
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.Equal(t, 3, len(data1))
+	err = c2.Load()
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.Equal(t, 3, len(data2))
+	assert.Equal(t, 3.00, data2["2022-06-03"]["USD"])
+
+	// A merge error aborts the save.
+	data2["2022-06-05"] = Rates{"USD": 5.00}
+	err = c2.Save()
+	assert.PassIf(t, err == nil, "%v", err)
+	c1.Merge = func(onDisk, inMemory *RatesCache) error {
+		return errors.New("merge failed")
+	}
+	data1["2022-06-06"] = Rates{"USD": 6.00}
+	err = c1.Save()
+	assert.PassIf(t, err != nil && err.Error() == "merge failed", "%v", err)
+
+	// A cache that has not been loaded or saved overwrites an existing cache file.
+	data3 := RatesCache{"2022-06-04": Rates{"USD": 4.00}}
+	c3 := New(&data3)
+	c3.CacheFile = file
+	err = c3.Save()
+	assert.PassIf(t, err == nil, "%v", err)
+	err = c2.Load()
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.Equal(t, 1, len(data2))
+}
+
+func TestNewForApp(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("XDG_CACHE_HOME is not used on Windows")
+	}
+	tmpdir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", tmpdir)
+	data := make(RatesCache)
+	r, err := NewForApp("xrate", "valuations", &data)
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.Equal(t, filepath.Join(tmpdir, "xrate", "valuations.json"), r.CacheFile)
+	assert.True(t, fsx.DirExists(filepath.Join(tmpdir, "xrate")))
+	data["2022-06-01"] = Rates{"USD": 1.00}
+	err = r.Save()
+	assert.PassIf(t, err == nil, "%v", err)
+
+	assert.Equal(t, JSON, r.Codec)
+
+	r, err = NewForApp("xrate", "valuations.gob", &data)
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.Equal(t, filepath.Join(tmpdir, "xrate", "valuations.gob"), r.CacheFile)
+	assert.Equal(t, Gob, r.Codec)
+	err = r.Save()
+	assert.PassIf(t, err == nil, "%v", err)
+	var loaded RatesCache
+	r2 := New(&loaded)
+	r2.CacheFile = r.CacheFile
+	r2.Codec = Gob
+	err = r2.Load()
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.Equal(t, 1, len(loaded))
+
+	_, err = NewForApp("xrate", "valuations.txt", &data)
+	assert.PassIf(t, err != nil, "expected error")
+
+	_, err = NewForApp("", "valuations", &data)
+	assert.PassIf(t, err != nil, "expected error")
+}
+
+func TestNoCacheFile(t *testing.T) {
+	data := make(RatesCache)
+	r := New(&data)
+	err := r.Load()
+	assert.PassIf(t, errors.Is(err, ErrNoCacheFile), "expected ErrNoCacheFile: %v", err)
+	data["2022-06-01"] = Rates{"USD": 1.00}
+	err = r.Save()
+	assert.PassIf(t, errors.Is(err, ErrNoCacheFile), "expected ErrNoCacheFile: %v", err)
+	err = r.LoadLocked()
+	assert.PassIf(t, errors.Is(err, ErrNoCacheFile), "expected ErrNoCacheFile: %v", err)
+}
+
+func TestReadUpdate(t *testing.T) {
+	var data Counter
+	c := New(&data)
+	c.CacheFile = filepath.Join(t.TempDir(), "counter.json")
+	const writers, readers, updates = 4, 4, 100
+	var wg sync.WaitGroup
+	for range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range updates {
+				err := c.Update(func(data *Counter) error {
+					data.Count++
+					return nil
+				})
+				if err != nil {
+					t.Errorf("Update failed with error: %v", err)
+				}
+			}
+		}()
+	}
+	for range readers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range updates {
+				c.Read(func(data *Counter) {
+					if data.Count < 0 {
+						t.Errorf("unexpected count: %v", data.Count)
+					}
+				})
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for range updates / 10 {
+			if err := c.Save(); err != nil {
+				t.Errorf("Save failed with error: %v", err)
+			}
+		}
+	}()
+	wg.Wait()
+	assert.Equal(t, writers*updates, data.Count)
+	err := c.Update(func(data *Counter) error {
+		data.Count++
+		return nil
+	})
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.True(t, c.IsDirty())
+	err = c.Save()
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.False(t, c.IsDirty())
+
+	var loaded Counter
+	c2 := New(&loaded)
+	c2.CacheFile = c.CacheFile
+	err = c2.Load()
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.Equal(t, writers*updates+1, loaded.Count)
+
+	// Failed updates do not mark the cache dirty.
+	err = c.Update(func(data *Counter) error {
+		return errors.New("failed")
+	})
+	assert.PassIf(t, err != nil, "expected error")
+	assert.False(t, c.IsDirty())
+}
+
+func TestLifecycle(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "valuations.json")
+	data := make(RatesCache)
+	c := New(&data)
+	c.CacheFile = file
+	assert.False(t, c.Exists())
+	assert.True(t, c.IsDirty())
+	assert.True(t, c.LastSaved().IsZero())
+	assert.True(t, c.LastLoaded().IsZero())
+
+	data["2022-06-01"] = Rates{"USD": 1.00}
+	before := time.Now()
+	err := c.Save()
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.True(t, c.Exists())
+	assert.False(t, c.IsDirty())
+	assert.False(t, c.LastSaved().Before(before))
+	assert.True(t, c.LastLoaded().IsZero())
+
+	// Changes made without Update are detected.
+	data["2022-06-01"]["USD"] = 2.00
+	assert.True(t, c.IsDirty())
+	data["2022-06-01"]["USD"] = 1.00
+	assert.False(t, c.IsDirty())
+
+	loaded := make(RatesCache)
+	c2 := New(&loaded)
+	c2.CacheFile = file
+	before = time.Now()
+	err = c2.Load()
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.False(t, c2.IsDirty())
+	assert.False(t, c2.LastLoaded().Before(before))
+	info, _ := os.Stat(file)
+	assert.Equal(t, info.ModTime(), c2.LastSaved())
+
+	// The saved time is recorded in the cache file envelope.
+	c.TTL = time.Hour
+	data["2022-06-01"]["EUR"] = 1.07
+	before = time.Now()
+	err = c.Save()
+	assert.PassIf(t, err == nil, "%v", err)
+	err = c2.Load()
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.False(t, c2.LastSaved().Before(before))
+	assert.False(t, c2.LastSaved().After(c.LastSaved()))
+
+	c2.Reset()
+	assert.Equal(t, 0, len(loaded))
+	assert.True(t, c2.IsDirty())
+	assert.True(t, c2.Exists())
+
+	err = c2.Delete()
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.False(t, c2.Exists())
+	err = c2.Delete()
+	assert.PassIf(t, err == nil, "%v", err)
+	// Unchanged cache data is not rewritten and a deleted cache file is not a conflict.
+	err = c.Save()
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.False(t, c.Exists())
+	data["2022-06-02"] = Rates{"USD": 2.00}
+	err = c.Save()
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.True(t, c.Exists())
+}
@@ -0,0 +1,57 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+)
+
+// Codec encodes and decodes cache data.
+type Codec interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+	Ext() string // Cache file name extension e.g. ".json".
+}
+
+// Built-in codecs.
+var (
+	JSON        Codec = jsonCodec{indent: "  "} // Indented JSON, the default codec.
+	CompactJSON Codec = jsonCodec{}             // JSON without indentation.
+	// Gob is compact and fast but map iteration order is random so caches containing maps are rewritten by every Save.
+	Gob Codec = gobCodec{}
+)
+
+type jsonCodec struct {
+	indent string
+}
+
+func (jc jsonCodec) Marshal(v any) ([]byte, error) {
+	if jc.indent == "" {
+		return json.Marshal(v)
+	}
+	return json.MarshalIndent(v, "", jc.indent)
+}
+
+func (jc jsonCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+func (jc jsonCodec) Ext() string {
+	return ".json"
+}
+
+type gobCodec struct{}
+
+func (gc gobCodec) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(v)
+	return buf.Bytes(), err
+}
+
+func (gc gobCodec) Unmarshal(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+func (gc gobCodec) Ext() string {
+	return ".gob"
+}
@@ -0,0 +1,56 @@
+package cache
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/srackham/go-utils/assert"
+	"github.com/srackham/go-utils/fsx"
+	"github.com/srackham/go-utils/helpers"
+)
+
+func TestCodecs(t *testing.T) {
+	tmpdir := t.TempDir()
+	data := RatesCache{
+		"2022-06-01": Rates{"USD": 1.00, "EUR": 1.07},
+		"2022-06-02": Rates{"USD": 1.00, "NZD": 0.64},
+	}
+	sizes := map[string]int64{}
+	for name, codec := range map[string]Codec{"json": JSON, "compact": CompactJSON, "gob": Gob} {
+		saved := helpers.CopyMap(data)
+		c := New(&saved)
+		c.Codec = codec
+		c.CacheFile = filepath.Join(tmpdir, name+codec.Ext())
+		err := c.Save()
+		assert.PassIf(t, err == nil, "%v: %v", name, err)
+		info, err := os.Stat(c.CacheFile)
+		assert.PassIf(t, err == nil, "%v: %v", name, err)
+		sizes[name] = info.Size()
+
+		loaded := make(RatesCache)
+		c2 := New(&loaded)
+		c2.Codec = codec
+		c2.CacheFile = c.CacheFile
+		err = c2.Load()
+		assert.PassIf(t, err == nil, "%v: %v", name, err)
+		assert.PassIf(t, reflect.DeepEqual(data, loaded), "%v: expected:\n%v\n\ngot:\n%v", name, data, loaded)
+	}
+	assert.PassIf(t, sizes["compact"] < sizes["json"], "compact JSON is not smaller: %v", sizes)
+	assert.Equal(t, ".json", CompactJSON.Ext())
+	assert.Equal(t, ".gob", Gob.Ext())
+}
+
+func TestDefaultCodec(t *testing.T) {
+	data := RatesCache{"2022-06-01": Rates{"USD": 1.00}}
+	c := New(&data)
+	c.CacheFile = filepath.Join(t.TempDir(), "valuations.json")
+	err := c.Save()
+	assert.PassIf(t, err == nil, "%v", err)
+	s, err := fsx.ReadFile(c.CacheFile)
+	assert.PassIf(t, err == nil, "%v", err)
+	want, _ := json.MarshalIndent(data, "", "  ")
+	assert.EqualStrings(t, string(want), s)
+}
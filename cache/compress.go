@@ -0,0 +1,37 @@
+package cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+)
+
+// gzipMagic identifies gzip compressed cache files.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+func isCompressed(data []byte) bool {
+	return bytes.HasPrefix(data, gzipMagic)
+}
+
+// compress returns gzip compressed data. The output is deterministic so unchanged data compresses to identical bytes.
+func compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decompress returns the decompressed data, ErrTooLarge is returned if it exceeds max bytes (zero is unlimited).
+func decompress(data []byte, max int64) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(&limitReader{r: zr, max: max})
+}
@@ -0,0 +1,70 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/srackham/go-utils/assert"
+)
+
+func TestCompress(t *testing.T) {
+	tmpdir := t.TempDir()
+	data := make(RatesCache)
+	for day := 1; day <= 30; day++ {
+		data[fmt.Sprintf("2022-06-%02d", day)] = Rates{"USD": 1.00, "EUR": 1.07, "NZD": 0.64}
+	}
+	plain := New(&data)
+	plain.CacheFile = filepath.Join(tmpdir, "plain.json")
+	err := plain.Save()
+	assert.PassIf(t, err == nil, "%v", err)
+
+	compressed := New(&data)
+	compressed.Compress = true
+	compressed.CacheFile = filepath.Join(tmpdir, "compressed.json")
+	err = compressed.Save()
+	assert.PassIf(t, err == nil, "%v", err)
+	plainBytes, _ := os.ReadFile(plain.CacheFile)
+	compressedBytes, _ := os.ReadFile(compressed.CacheFile)
+	assert.True(t, isCompressed(compressedBytes))
+	assert.PassIf(t, len(compressedBytes) < len(plainBytes), "compressed %d bytes, uncompressed %d bytes", len(compressedBytes), len(plainBytes))
+	// The data checksum is computed from the uncompressed data.
+	assert.Equal(t, plain.sha256, compressed.sha256)
+	assert.Equal(t, sha256.Sum256(compressedBytes), compressed.fileSHA256)
+
+	// Compressed and uncompressed files load regardless of the Compress option.
+	for _, file := range []string{plain.CacheFile, compressed.CacheFile} {
+		for _, opt := range []bool{false, true} {
+			loaded := make(RatesCache)
+			c := New(&loaded)
+			c.Compress = opt
+			c.CacheFile = file
+			err = c.Load()
+			assert.PassIf(t, err == nil, "%v", err)
+			assert.PassIf(t, reflect.DeepEqual(data, loaded), "%v: loaded data differs", file)
+		}
+	}
+
+	// Enabling compression on unchanged data does not rewrite the file.
+	loaded := make(RatesCache)
+	c := New(&loaded)
+	c.CacheFile = plain.CacheFile
+	err = c.Load()
+	assert.PassIf(t, err == nil, "%v", err)
+	c.Compress = true
+	err = c.Save()
+	assert.PassIf(t, err == nil, "%v", err)
+	b, _ := os.ReadFile(plain.CacheFile)
+	assert.False(t, isCompressed(b))
+	// Changed data is written compressed.
+	loaded["2022-07-01"] = Rates{"USD": 1.00}
+	err = c.Save()
+	assert.PassIf(t, err == nil, "%v", err)
+	b, _ = os.ReadFile(plain.CacheFile)
+	assert.True(t, isCompressed(b))
+	err = c.Save()
+	assert.PassIf(t, err == nil, "%v", err)
+}
@@ -0,0 +1,303 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/srackham/go-utils/fsx"
+)
+
+// DirStore persists key/value records in a directory, each record is stored in its own file. Record files are
+// written atomically and only when the record has changed. DirStore is goroutine-safe.
+//
+// Record file names are derived from the key: string keys are used verbatim and other keys are JSON encoded, then
+// characters other than ASCII letters, digits, '-', '_' and non-leading '.' are percent-encoded and the Codec file
+// name extension is appended. Keys that differ only by case share a file on case-insensitive file systems. If the
+// encoded key is longer than maxNameLen the file is named with '~' followed by the hex encoded SHA-256 checksum of the
+// key, and the key is stored in the record file alongside the value.
+type DirStore[K comparable, V any] struct {
+	Dir   string
+	Codec Codec // Record file encoding (defaults to JSON).
+	mu    sync.Mutex
+	shas  map[K][32]byte // Checksums of record files as they were last read or written.
+}
+
+// maxNameLen is the maximum length of a percent-encoded key record file name, it leaves room for the file name
+// extension and the atomic write temporary file suffix within the common 255 byte file name limit.
+const maxNameLen = 200
+
+// hashedPrefix starts hashed record file names, escapeName never produces it.
+const hashedPrefix = "~"
+
+// hashedRecord is the contents of a hashed record file.
+type hashedRecord[V any] struct {
+	Key   string // The key string (see keyString).
+	Value V
+}
+
+func NewDirStore[K comparable, V any](dir string) *DirStore[K, V] {
+	return &DirStore[K, V]{Dir: dir}
+}
+
+// Get returns the record for key and true, or the zero value and false if there is no record for key.
+func (ds *DirStore[K, V]) Get(key K) (V, bool, error) {
+	var value V
+	s, err := ds.keyString(key)
+	if err != nil {
+		return value, false, err
+	}
+	path := ds.path(s)
+	// Hold the lock so a concurrent Put cannot replace the file before its checksum is recorded.
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return value, false, nil
+	}
+	if err != nil {
+		return value, false, err
+	}
+	if isHashed(s) {
+		var rec hashedRecord[V]
+		if err := ds.codec().Unmarshal(data, &rec); err != nil {
+			return value, false, &CorruptError{Path: path, Err: err}
+		}
+		if rec.Key != s {
+			return value, false, &CorruptError{Path: path, Err: errors.New("record key mismatch")}
+		}
+		value = rec.Value
+	} else if err := ds.codec().Unmarshal(data, &value); err != nil {
+		return value, false, &CorruptError{Path: path, Err: err}
+	}
+	ds.setSHA(key, sha256.Sum256(data))
+	return value, true, nil
+}
+
+// Put writes the record for key unless the record file already contains value. The directory is created if it does
+// not exist.
+func (ds *DirStore[K, V]) Put(key K, value V) error {
+	s, err := ds.keyString(key)
+	if err != nil {
+		return err
+	}
+	path := ds.path(s)
+	var data []byte
+	if isHashed(s) {
+		data, err = ds.codec().Marshal(hashedRecord[V]{Key: s, Value: value})
+	} else {
+		data, err = ds.codec().Marshal(value)
+	}
+	if err != nil {
+		return err
+	}
+	sha := sha256.Sum256(data)
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	if ds.unchanged(key, path, sha) {
+		return nil
+	}
+	if err := fsx.MkMissingDir(ds.Dir); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return err
+	}
+	ds.setSHA(key, sha)
+	return nil
+}
+
+// unchanged returns true if record file path, for key, has checksum sha. If the checksum of the file was not
+// recorded when it was last read or written the file is read. The caller must hold the lock.
+func (ds *DirStore[K, V]) unchanged(key K, path string, sha [32]byte) bool {
+	if prev, ok := ds.shas[key]; ok {
+		return prev == sha && fsx.FileExists(path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || sha256.Sum256(data) != sha {
+		return false
+	}
+	ds.setSHA(key, sha)
+	return true
+}
+
+// setSHA records the checksum of the record file for key, the caller must hold the lock.
+func (ds *DirStore[K, V]) setSHA(key K, sha [32]byte) {
+	if ds.shas == nil {
+		ds.shas = make(map[K][32]byte)
+	}
+	ds.shas[key] = sha
+}
+
+// Delete removes the record for key, it is not an error if there is no record.
+func (ds *DirStore[K, V]) Delete(key K) error {
+	path, err := ds.Path(key)
+	if err != nil {
+		return err
+	}
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	delete(ds.shas, key)
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// List returns the keys of all records sorted by record file name. Files whose names are not valid record file names
+// are ignored.
+func (ds *DirStore[K, V]) List() ([]K, error) {
+	entries, err := os.ReadDir(ds.Dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	ext := ds.codec().Ext()
+	var keys []K
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ext)
+		if !ok || !entry.Type().IsRegular() {
+			continue
+		}
+		var s string
+		if strings.HasPrefix(name, hashedPrefix) {
+			s, err = ds.hashedKey(filepath.Join(ds.Dir, entry.Name()))
+		} else {
+			s, err = unescapeName(name)
+		}
+		if err != nil {
+			continue
+		}
+		if key, err := ds.decodeKey(s); err == nil {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// Path returns the record file path for key.
+func (ds *DirStore[K, V]) Path(key K) (string, error) {
+	s, err := ds.keyString(key)
+	if err != nil {
+		return "", err
+	}
+	return ds.path(s), nil
+}
+
+// path returns the record file path for key string s (see keyString).
+func (ds *DirStore[K, V]) path(s string) string {
+	name := escapeName(s)
+	if isHashed(s) {
+		sha := sha256.Sum256([]byte(s))
+		name = hashedPrefix + hex.EncodeToString(sha[:])
+	}
+	return filepath.Join(ds.Dir, name+ds.codec().Ext())
+}
+
+// isHashed returns true if the record file for key string s has a hashed name.
+func isHashed(s string) bool {
+	return strings.HasPrefix(s, hashedPrefix) || len(escapeName(s)) > maxNameLen
+}
+
+// hashedKey returns the key string stored in hashed record file path.
+func (ds *DirStore[K, V]) hashedKey(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	var rec hashedRecord[V]
+	if err := ds.codec().Unmarshal(data, &rec); err != nil {
+		return "", err
+	}
+	return rec.Key, nil
+}
+
+func (ds *DirStore[K, V]) codec() Codec {
+	if ds.Codec == nil {
+		return JSON
+	}
+	return ds.Codec
+}
+
+// isStringKey returns true if K's underlying type is string.
+func (ds *DirStore[K, V]) isStringKey() bool {
+	return reflect.TypeFor[K]().Kind() == reflect.String
+}
+
+// keyString returns the string the record file name for key is derived from: string keys are used verbatim, other
+// keys are JSON encoded.
+func (ds *DirStore[K, V]) keyString(key K) (string, error) {
+	var s string
+	if ds.isStringKey() {
+		s = reflect.ValueOf(key).String()
+	} else {
+		b, err := json.Marshal(key)
+		if err != nil {
+			return "", err
+		}
+		s = string(b)
+	}
+	if s == "" {
+		return "", errors.New("cache: empty DirStore key")
+	}
+	return s, nil
+}
+
+// decodeKey reverses keyString.
+func (ds *DirStore[K, V]) decodeKey(s string) (K, error) {
+	var key K
+	if ds.isStringKey() {
+		reflect.ValueOf(&key).Elem().SetString(s)
+		return key, nil
+	}
+	err := json.Unmarshal([]byte(s), &key)
+	return key, err
+}
+
+// escapeName percent-encodes the characters in s that are not safe in file names.
+func escapeName(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' && i > 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// unescapeName reverses escapeName.
+func unescapeName(name string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		if name[i] != '%' {
+			b.WriteByte(name[i])
+			continue
+		}
+		if i+2 >= len(name) {
+			return "", fmt.Errorf("cache: invalid escape in file name: %q", name)
+		}
+		c, err := strconv.ParseUint(name[i+1:i+3], 16, 8)
+		if err != nil {
+			return "", fmt.Errorf("cache: invalid escape in file name: %q", name)
+		}
+		b.WriteByte(byte(c))
+		i += 2
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,185 @@
+package cache
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/srackham/go-utils/assert"
+	"github.com/srackham/go-utils/fsx"
+)
+
+func TestDirStore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "rates")
+	ds := NewDirStore[string, Rates](dir)
+	keys, err := ds.List()
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.Equal(t, 0, len(keys))
+	_, ok, err := ds.Get("2022-06-01")
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.False(t, ok)
+
+	for _, key := range []string{"2022-06-01", "a/b", "..", ".hidden", "100%", "ünï", "a b"} {
+		err = ds.Put(key, Rates{"USD": 1.00})
+		assert.PassIf(t, err == nil, "%v", err)
+		path, err := ds.Path(key)
+		assert.PassIf(t, err == nil, "%v", err)
+		assert.Equal(t, dir, filepath.Dir(path))
+		v, ok, err := ds.Get(key)
+		assert.PassIf(t, err == nil, "%v", err)
+		assert.True(t, ok)
+		assert.Equal(t, 1.00, v["USD"])
+	}
+	// Files that are not records are ignored.
+	fsx.WriteFile(filepath.Join(dir, "README.txt"), "")
+	fsx.WriteFile(filepath.Join(dir, "bad%G0.json"), "")
+	keys, err = ds.List()
+	assert.PassIf(t, err == nil, "%v", err)
+	// Keys are sorted by record file name.
+	assert.EqualValues(t, []string{"..", ".hidden", "ünï", "100%", "2022-06-01", "a b", "a/b"}, keys)
+	assert.Equal(t, 9, fsx.DirCount(dir))
+
+	err = ds.Delete("a/b")
+	assert.PassIf(t, err == nil, "%v", err)
+	err = ds.Delete("a/b")
+	assert.PassIf(t, err == nil, "%v", err)
+	_, ok, _ = ds.Get("a/b")
+	assert.False(t, ok)
+	_, err = ds.Path("")
+	assert.PassIf(t, err != nil, "expected empty key error")
+}
+
+func TestDirStoreUnchanged(t *testing.T) {
+	dir := t.TempDir()
+	ds := NewDirStore[string, Rates](dir)
+	err := ds.Put("2022-06-01", Rates{"USD": 1.00})
+	assert.PassIf(t, err == nil, "%v", err)
+	path, _ := ds.Path("2022-06-01")
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	os.Chtimes(path, past, past)
+
+	// Unchanged records are not rewritten.
+	err = ds.Put("2022-06-01", Rates{"USD": 1.00})
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.Equal(t, past, fsx.FileModTime(path))
+	ds2 := NewDirStore[string, Rates](dir)
+	_, _, err = ds2.Get("2022-06-01")
+	assert.PassIf(t, err == nil, "%v", err)
+	err = ds2.Put("2022-06-01", Rates{"USD": 1.00})
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.Equal(t, past, fsx.FileModTime(path))
+	// A new DirStore compares the record file contents.
+	err = NewDirStore[string, Rates](dir).Put("2022-06-01", Rates{"USD": 1.00})
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.Equal(t, past, fsx.FileModTime(path))
+
+	// Changed records are rewritten.
+	err = ds.Put("2022-06-01", Rates{"USD": 2.00})
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.NotEqual(t, past, fsx.FileModTime(path))
+
+	// Corrupt records.
+	fsx.WriteFile(path, "{")
+	_, _, err = ds.Get("2022-06-01")
+	var corruptErr *CorruptError
+	assert.PassIf(t, errors.As(err, &corruptErr), "expected *CorruptError: %v", err)
+	assert.Equal(t, path, corruptErr.Path)
+}
+
+func TestDirStoreLongKeys(t *testing.T) {
+	dir := t.TempDir()
+	ds := NewDirStore[string, float64](dir)
+	url := "https://example.com/api/v1/rates?" + strings.Repeat("currency=EUR&", 20)
+	for i, key := range []string{url, strings.Repeat("/", 90), "~tilde", "short"} {
+		err := ds.Put(key, float64(i))
+		assert.PassIf(t, err == nil, "%v", err)
+		path, _ := ds.Path(key)
+		assert.PassIf(t, len(filepath.Base(path)) <= maxNameLen+len(JSON.Ext()), "file name too long: %v", path)
+		v, ok, err := NewDirStore[string, float64](dir).Get(key)
+		assert.PassIf(t, err == nil && ok, "%v", err)
+		assert.Equal(t, float64(i), v)
+	}
+	path, _ := ds.Path(url)
+	assert.PassIf(t, strings.HasPrefix(filepath.Base(path), "~"), "expected hashed file name: %v", path)
+	keys, err := ds.List()
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.Equal(t, 4, len(keys))
+	assert.True(t, slices.Contains(keys, url))
+	assert.True(t, slices.Contains(keys, "~tilde"))
+
+	// Unchanged hashed records are not rewritten.
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	os.Chtimes(path, past, past)
+	err = NewDirStore[string, float64](dir).Put(url, 0)
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.Equal(t, past, fsx.FileModTime(path))
+
+	err = ds.Delete(url)
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.False(t, fsx.FileExists(path))
+}
+
+type recordKey struct {
+	Date     string
+	Currency string
+}
+
+func TestDirStoreKeys(t *testing.T) {
+	dir := t.TempDir()
+	ints := NewDirStore[int, string](dir)
+	ints.Codec = Gob
+	for _, k := range []int{3, -1, 20} {
+		err := ints.Put(k, "value")
+		assert.PassIf(t, err == nil, "%v", err)
+	}
+	keys, err := ints.List()
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.EqualValues(t, []int{-1, 20, 3}, keys)
+
+	structs := NewDirStore[recordKey, float64](dir)
+	key := recordKey{"2022-06-01", "EUR"}
+	err = structs.Put(key, 1.07)
+	assert.PassIf(t, err == nil, "%v", err)
+	v, ok, err := structs.Get(key)
+	assert.PassIf(t, err == nil && ok, "%v", err)
+	assert.Equal(t, 1.07, v)
+	rkeys, err := structs.List()
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.EqualValues(t, []recordKey{key}, rkeys)
+}
+
+func TestDirStoreConcurrency(t *testing.T) {
+	dir := t.TempDir()
+	ds := &DirStore[string, float64]{Dir: dir} // The zero value is ready to use.
+	var wg sync.WaitGroup
+	for i := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range 50 {
+				var err error
+				if i%2 == 0 {
+					err = ds.Put("EUR", float64(j%2))
+				} else {
+					_, _, err = ds.Get("EUR")
+				}
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	for _, want := range []float64{1, 0} {
+		err := ds.Put("EUR", want)
+		assert.PassIf(t, err == nil, "%v", err)
+		v, ok, err := NewDirStore[string, float64](dir).Get("EUR")
+		assert.PassIf(t, err == nil && ok, "%v", err)
+		assert.Equal(t, want, v)
+	}
+}
@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// ErrDecrypt is returned by Load when an encrypted cache file cannot be decrypted with Cache.Key, either because the
+// key is wrong or the file has been tampered with.
+var ErrDecrypt = errors.New("cache: cache file decryption failed")
+
+// ErrNoKey is returned by Load when the cache file is encrypted and Cache.Key has not been set.
+var ErrNoKey = errors.New("cache: encrypted cache file requires Cache.Key")
+
+// encryptedMagic prefixes encrypted cache files, it is followed by the AES-GCM nonce and the sealed file contents.
+var encryptedMagic = []byte("#go-utils-cache-aesgcm\n")
+
+// KeyIterations is the number of PBKDF2 iterations used by KeyFromPassphrase.
+const KeyIterations = 600_000
+
+// KeyFromPassphrase derives a 32 byte AES-256 Cache.Key from passphrase using PBKDF2 with HMAC-SHA256. The salt
+// should be unique to the application and must not change once cache files have been saved.
+func KeyFromPassphrase(passphrase string, salt []byte) []byte {
+	return pbkdf2.Key([]byte(passphrase), salt, KeyIterations, 32, sha256.New)
+}
+
+func isEncrypted(file []byte) bool {
+	return bytes.HasPrefix(file, encryptedMagic)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encrypt seals data with AES-GCM using a random nonce.
+func encrypt(key, data []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]byte, len(encryptedMagic)+gcm.NonceSize(), len(encryptedMagic)+gcm.NonceSize()+len(data)+gcm.Overhead())
+	copy(result, encryptedMagic)
+	nonce := result[len(encryptedMagic):]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(result, nonce, data, nil), nil
+}
+
+// decrypt opens data sealed by encrypt.
+func decrypt(key, file []byte) ([]byte, error) {
+	if len(key) == 0 {
+		return nil, ErrNoKey
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	sealed := file[len(encryptedMagic):]
+	if len(sealed) < gcm.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	data, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return data, nil
+}
@@ -0,0 +1,90 @@
+package cache
+
+import (
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/srackham/go-utils/assert"
+	"github.com/srackham/go-utils/fsx"
+)
+
+func TestKeyFromPassphrase(t *testing.T) {
+	key := KeyFromPassphrase("secret", []byte("xrate"))
+	assert.Equal(t, "49f4a9ccd79c2a0d20d11c89c30933d32ad5c9ddae27a4eb30a21774a5d5e80d", hex.EncodeToString(key))
+}
+
+func TestEncryption(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "accounts.json")
+	key := KeyFromPassphrase("secret", []byte("xrate"))
+	data := map[string]string{"token": "s3cr3t-api-token"}
+	c := New(&data)
+	c.CacheFile = file
+	c.Key = key
+	c.Compress = true
+	c.Checksum = true
+	err := c.Save()
+	assert.PassIf(t, err == nil, "%v", err)
+	s, _ := fsx.ReadFile(file)
+	assert.NotContains(t, s, "s3cr3t")
+	assert.True(t, isEncrypted([]byte(s)))
+
+	loaded := map[string]string{}
+	c2 := New(&loaded)
+	c2.CacheFile = file
+	c2.Key = key
+	err = c2.Load()
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.Equal(t, "s3cr3t-api-token", loaded["token"])
+
+	// Decryption failures do not move the cache file aside.
+	c2.Key = KeyFromPassphrase("wrong", []byte("xrate"))
+	loaded = map[string]string{}
+	err = c2.Load()
+	assert.PassIf(t, errors.Is(err, ErrDecrypt), "expected ErrDecrypt: %v", err)
+	assert.Equal(t, 0, len(loaded))
+	assert.True(t, fsx.FileExists(file))
+	c2.Key = nil
+	err = c2.Load()
+	assert.PassIf(t, errors.Is(err, ErrNoKey), "expected ErrNoKey: %v", err)
+
+	// Tampered files fail authentication.
+	c.Checksum = false
+	data["token"] = "new-token"
+	err = c.Save()
+	assert.PassIf(t, err == nil, "%v", err)
+	b, _ := os.ReadFile(file)
+	b[len(b)-1] ^= 1
+	err = os.WriteFile(file, b, 0644)
+	assert.PassIf(t, err == nil, "%v", err)
+	c2.Key = key
+	err = c2.Load()
+	assert.PassIf(t, errors.Is(err, ErrDecrypt), "expected ErrDecrypt: %v", err)
+}
+
+func TestEncryptPlaintextFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "accounts.json")
+	data := map[string]string{"token": "s3cr3t-api-token"}
+	c := New(&data)
+	c.CacheFile = file
+	err := c.Save()
+	assert.PassIf(t, err == nil, "%v", err)
+
+	// Plaintext files load when a key is set and are encrypted by the next save.
+	loaded := map[string]string{}
+	c2 := New(&loaded)
+	c2.CacheFile = file
+	c2.Key = KeyFromPassphrase("secret", []byte("xrate"))
+	err = c2.Load()
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.Equal(t, "s3cr3t-api-token", loaded["token"])
+	err = c2.Save()
+	assert.PassIf(t, err == nil, "%v", err)
+	s, _ := fsx.ReadFile(file)
+	assert.NotContains(t, s, "s3cr3t")
+	err = c2.Load()
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.Equal(t, "s3cr3t-api-token", loaded["token"])
+}
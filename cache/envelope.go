@@ -0,0 +1,71 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// ErrExpired is returned by Load when the cache data is older than the TTL it was saved with.
+var ErrExpired = errors.New("cache: cache data has expired")
+
+// envelopeMagic prefixes cache files that have an envelope. The envelope is a single line containing the magic
+// followed by the JSON encoded envelope metadata, the encoded cache data follows the envelope line.
+var envelopeMagic = []byte("#go-utils-cache ")
+
+// envelope records cache file metadata. Files are only written with an envelope when there is metadata to record.
+type envelope struct {
+	SavedAt time.Time     `json:"savedAt"`
+	TTL     time.Duration `json:"ttl,omitempty"`
+	Version int           `json:"version,omitempty"` // Cache data schema version.
+}
+
+// expired returns true if the data was saved with a TTL that has elapsed.
+func (e envelope) expired() bool {
+	return e.TTL > 0 && time.Since(e.SavedAt) > e.TTL
+}
+
+// wrap prepends the envelope line to data.
+func (e envelope) wrap(data []byte) ([]byte, error) {
+	meta, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]byte, 0, len(envelopeMagic)+len(meta)+1+len(data))
+	result = append(result, envelopeMagic...)
+	result = append(result, meta...)
+	result = append(result, '\n')
+	return append(result, data...), nil
+}
+
+// unwrap splits the envelope from data. If data has no envelope it is returned unchanged with a zero envelope.
+func unwrap(data []byte) (envelope, []byte, error) {
+	var e envelope
+	if !bytes.HasPrefix(data, envelopeMagic) {
+		return e, data, nil
+	}
+	meta, rest, ok := bytes.Cut(data[len(envelopeMagic):], []byte("\n"))
+	if !ok {
+		return e, nil, errors.New("cache: missing cache file envelope terminator")
+	}
+	if err := json.Unmarshal(meta, &e); err != nil {
+		return e, nil, err
+	}
+	return e, rest, nil
+}
+
+// readEnvelope reads the envelope line, if there is one, from r.
+func readEnvelope(r *bufio.Reader) (envelope, error) {
+	var e envelope
+	if head, _ := r.Peek(len(envelopeMagic)); !bytes.Equal(head, envelopeMagic) {
+		return e, nil
+	}
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		return e, errors.New("cache: missing cache file envelope terminator")
+	}
+	err = json.Unmarshal(line[len(envelopeMagic):len(line)-1], &e)
+	return e, err
+}
@@ -0,0 +1,86 @@
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/srackham/go-utils/assert"
+)
+
+// writeExpired writes a cache file containing data that expired an hour ago.
+func writeExpired(t *testing.T, file string, data []byte) {
+	t.Helper()
+	env := envelope{SavedAt: time.Now().Add(-2 * time.Hour), TTL: time.Hour}
+	b, err := env.wrap(data)
+	assert.PassIf(t, err == nil, "%v", err)
+	err = os.WriteFile(file, b, 0644)
+	assert.PassIf(t, err == nil, "%v", err)
+}
+
+func TestTTL(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "valuations.json")
+	data := RatesCache{"2022-06-01": Rates{"USD": 1.00}}
+	c := New(&data)
+	c.CacheFile = file
+	c.TTL = time.Hour
+	err := c.Save()
+	assert.PassIf(t, err == nil, "%v", err)
+	b, _ := os.ReadFile(file)
+	assert.True(t, bytes.HasPrefix(b, envelopeMagic))
+	env, rest, err := unwrap(b)
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.Equal(t, time.Hour, env.TTL)
+	assert.PassIf(t, time.Since(env.SavedAt) < time.Minute, "unexpected saved at time: %v", env.SavedAt)
+	assert.False(t, env.expired())
+
+	loaded := make(RatesCache)
+	c2 := New(&loaded)
+	c2.CacheFile = file
+	err = c2.Load()
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.Equal(t, 1.00, loaded["2022-06-01"]["USD"])
+
+	// Expired data is not loaded.
+	writeExpired(t, file, rest)
+	loaded = RatesCache{"2022-07-01": Rates{"USD": 2.00}}
+	err = c2.Load()
+	assert.PassIf(t, errors.Is(err, ErrExpired), "expected ErrExpired: %v", err)
+	assert.Equal(t, 1, len(loaded))
+	assert.Equal(t, 2.00, loaded["2022-07-01"]["USD"])
+	// Refreshed data is saved even though it is the same as the expired data.
+	c2.TTL = time.Hour
+	err = c2.Save()
+	assert.PassIf(t, err == nil, "%v", err)
+	err = c2.Load()
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.Equal(t, 2.00, loaded["2022-07-01"]["USD"])
+
+	// Expired data is reset.
+	writeExpired(t, file, rest)
+	c2.ResetExpired = true
+	err = c2.Load()
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.True(t, loaded == nil)
+}
+
+func TestTTLCompressed(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "valuations.json")
+	data := RatesCache{"2022-06-01": Rates{"USD": 1.00}}
+	c := New(&data)
+	c.CacheFile = file
+	c.TTL = time.Hour
+	c.Compress = true
+	err := c.Save()
+	assert.PassIf(t, err == nil, "%v", err)
+	loaded := make(RatesCache)
+	c2 := New(&loaded)
+	c2.CacheFile = file
+	err = c2.Load()
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.Equal(t, 1.00, loaded["2022-06-01"]["USD"])
+	assert.Equal(t, c.sha256, c2.sha256)
+}
@@ -0,0 +1,91 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"time"
+)
+
+// ErrChecksum is wrapped by CorruptError when the cache file checksum trailer does not match the file contents.
+var ErrChecksum = errors.New("checksum mismatch")
+
+// CorruptError is returned by Load when the cache file cannot be decoded. The corrupt file is renamed aside so the
+// next Save does not overwrite it.
+type CorruptError struct {
+	Path    string // Cache file path.
+	MovedTo string // Path the corrupt file was renamed to, empty if it was not renamed.
+	Err     error  // The decoding error.
+}
+
+func (e *CorruptError) Error() string {
+	msg := "cache: corrupt cache file " + e.Path + ": " + e.Err.Error()
+	if e.MovedTo != "" {
+		msg += " (moved to " + e.MovedTo + ")"
+	}
+	return msg
+}
+
+func (e *CorruptError) Unwrap() error {
+	return e.Err
+}
+
+// checksumMagic introduces the checksum trailer line that Save appends to the cache file when Cache.Checksum is set.
+// The trailer records the hex encoded SHA-256 checksum of the preceding file contents.
+var checksumMagic = []byte("\n#go-utils-cache-sha256 ")
+
+const checksumTrailerLen = len("\n#go-utils-cache-sha256 ") + sha256.Size*2 + 1
+
+// addChecksum appends the checksum trailer to file.
+func addChecksum(file []byte) []byte {
+	sha := sha256.Sum256(file)
+	result := make([]byte, 0, len(file)+checksumTrailerLen)
+	result = append(result, file...)
+	result = append(result, checksumMagic...)
+	result = hex.AppendEncode(result, sha[:])
+	return append(result, '\n')
+}
+
+// verifyChecksum verifies and removes the checksum trailer. Files without a trailer are returned unchanged.
+func verifyChecksum(file []byte) ([]byte, error) {
+	n := len(file) - checksumTrailerLen
+	if n < 0 || !bytes.HasPrefix(file[n:], checksumMagic) || file[len(file)-1] != '\n' {
+		return file, nil
+	}
+	var want [sha256.Size]byte
+	if _, err := hex.Decode(want[:], file[n+len(checksumMagic):len(file)-1]); err != nil {
+		return nil, err
+	}
+	if sha256.Sum256(file[:n]) != want {
+		return nil, ErrChecksum
+	}
+	return file[:n], nil
+}
+
+// quarantine renames the corrupt cache file, and its journal, aside and returns its new path, or an empty string if it was not renamed.
+// The file is not renamed if it has been replaced since it was read. locked is true if the caller holds the cache file
+// lock.
+func (c *Cache[T]) quarantine(file []byte, locked bool) string {
+	if !locked {
+		unlock, err := c.lockIfUnlocked(context.Background())
+		if err != nil {
+			return ""
+		}
+		defer unlock()
+	}
+	current, err := os.ReadFile(c.CacheFile)
+	if err != nil || !bytes.Equal(current, file) {
+		return ""
+	}
+	suffix := ".corrupt-" + time.Now().UTC().Format("20060102T150405.000Z")
+	path := c.CacheFile + suffix
+	if err := os.Rename(c.CacheFile, path); err != nil {
+		return ""
+	}
+	// The journal cannot be applied without its cache file.
+	os.Rename(c.JournalPath(), c.JournalPath()+suffix)
+	return path
+}
@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/srackham/go-utils/assert"
+	"github.com/srackham/go-utils/fsx"
+)
+
+func TestChecksum(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "valuations.json")
+	data := RatesCache{"2022-06-01": Rates{"USD": 1.00}}
+	c := New(&data)
+	c.CacheFile = file
+	c.Checksum = true
+	err := c.Save()
+	assert.PassIf(t, err == nil, "%v", err)
+	b, _ := os.ReadFile(file)
+	assert.Contains(t, string(b), string(checksumMagic))
+
+	loaded := make(RatesCache)
+	c2 := New(&loaded)
+	c2.CacheFile = file
+	err = c2.Load()
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.Equal(t, 1.00, loaded["2022-06-01"]["USD"])
+
+	// Modified data that is still valid JSON is detected by the checksum.
+	err = os.WriteFile(file, bytes.Replace(b, []byte("1"), []byte("2"), 1), 0644)
+	assert.PassIf(t, err == nil, "%v", err)
+	loaded["2022-06-01"]["USD"] = 3.00
+	err = c2.Load()
+	var corruptErr *CorruptError
+	assert.PassIf(t, errors.As(err, &corruptErr), "expected *CorruptError: %v", err)
+	assert.PassIf(t, errors.Is(err, ErrChecksum), "expected ErrChecksum: %v", err)
+	assert.Equal(t, file, corruptErr.Path)
+	assert.Equal(t, 3.00, loaded["2022-06-01"]["USD"])
+	assert.False(t, fsx.FileExists(file))
+	assert.True(t, fsx.FileExists(corruptErr.MovedTo))
+	assert.ContainsPattern(t, corruptErr.MovedTo, `valuations\.json\.corrupt-\d{8}T\d{6}\.\d{3}Z$`)
+
+	// The next Save writes a new cache file.
+	err = c2.Save()
+	assert.PassIf(t, err == nil, "%v", err)
+	err = c.Load()
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.Equal(t, 3.00, data["2022-06-01"]["USD"])
+}
+
+func TestCorruptFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "valuations.json")
+	data := RatesCache{"2022-06-01": Rates{"USD": 1.00}, "2022-06-02": Rates{"USD": 2.00}}
+	c := New(&data)
+	c.CacheFile = file
+	c.Compress = true
+	err := c.Save()
+	assert.PassIf(t, err == nil, "%v", err)
+	b, _ := os.ReadFile(file)
+
+	for _, corrupt := range [][]byte{
+		b[:len(b)/2],                                       // Truncated compressed file.
+		[]byte(`{"2022-06-01": {"USD": 1`),                 // Truncated JSON.
+		append([]byte("#go-utils-cache "), `{"ttl": 1`...), // Truncated envelope.
+	} {
+		err = os.WriteFile(file, corrupt, 0644)
+		assert.PassIf(t, err == nil, "%v", err)
+		loaded := RatesCache{"2022-07-01": Rates{"USD": 3.00}}
+		c2 := New(&loaded)
+		c2.CacheFile = file
+		err = c2.Load()
+		var corruptErr *CorruptError
+		assert.PassIf(t, errors.As(err, &corruptErr), "expected *CorruptError: %v", err)
+		assert.Equal(t, 1, len(loaded)) // The cache data is unchanged.
+		assert.Equal(t, 3.00, loaded["2022-07-01"]["USD"])
+		moved, _ := os.ReadFile(corruptErr.MovedTo)
+		assert.PassIf(t, bytes.Equal(corrupt, moved), "moved file differs from corrupt file")
+		os.Remove(corruptErr.MovedTo)
+	}
+}
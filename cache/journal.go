@@ -0,0 +1,216 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"reflect"
+	"time"
+
+	"github.com/srackham/go-utils/fsx"
+)
+
+// journalMagic introduces the journal file header line, it is followed by the hex encoded SHA-256 checksum of the
+// cache file the journal applies to. The header is followed by one JSON merge patch (RFC 7386) record per line.
+var journalMagic = []byte("#go-utils-cache-journal ")
+
+// journal is the parsed contents of a journal file.
+type journal struct {
+	records [][]byte // JSON merge patch records.
+	size    int64    // Size in bytes of the complete lines in the journal file.
+	valid   bool     // The journal header matches the cache file.
+}
+
+// JournalPath returns the path of the journal file, it sits alongside the cache file.
+func (c *Cache[T]) JournalPath() string {
+	return c.CacheFile + ".journal"
+}
+
+// Compact rewrites the cache file from the cache data and removes the journal (see Cache.Journal).
+func (c *Cache[T]) Compact() error {
+	if c.CacheFile == "" {
+		return ErrNoCacheFile
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data, err := c.marshal()
+	if err != nil {
+		return err
+	}
+	unlock, err := c.lockIfUnlocked(context.Background())
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if data, err = c.checkConflict(context.Background(), data); err != nil {
+		return err
+	}
+	return c.writeFile(data)
+}
+
+// checkJournal returns an error if the cache options are incompatible with journal mode.
+func (c *Cache[T]) checkJournal() error {
+	if _, ok := c.codec().(jsonCodec); !ok {
+		return errors.New("cache: journal mode requires a JSON codec")
+	}
+	if len(c.Key) > 0 {
+		return errors.New("cache: journal mode does not support encryption")
+	}
+	if c.TTL > 0 {
+		// Journal records do not update the cache file's save time so expiry would not be measured from the last save.
+		return errors.New("cache: journal mode does not support TTL")
+	}
+	return nil
+}
+
+// appendJournal appends a JSON merge patch record that converts the last saved cache data to data. A new journal is
+// started if the existing journal does not belong to the cache file. The caller must hold the mutex and the cache
+// file lock.
+func (c *Cache[T]) appendJournal(data []byte) error {
+	patch, err := diffJSON(c.journalBase, data)
+	if err != nil {
+		return err
+	}
+	if patch != nil {
+		path := c.JournalPath()
+		j, err := readJournal(path, c.fileSHA256)
+		if err != nil {
+			return err
+		}
+		line := append(patch, '\n')
+		if j.valid {
+			// Discard any incomplete record left by an interrupted append.
+			if err := os.Truncate(path, j.size); err != nil {
+				return err
+			}
+			err = fsx.AppendFile(path, string(line))
+		} else {
+			header := append(append([]byte{}, journalMagic...), hex.EncodeToString(c.fileSHA256[:])...)
+			header = append(header, '\n')
+			j.size = int64(len(header))
+			err = writeFileAtomic(path, append(header, line...))
+		}
+		if err != nil {
+			return err
+		}
+		c.journalSize = j.size + int64(len(line))
+	}
+	c.journalBase = data
+	c.sha256 = sha256.Sum256(data)
+	c.dirty = false
+	c.lastSaved = time.Now()
+	return nil
+}
+
+// readJournal reads journal file path. A trailing incomplete line, left by an interrupted append, is ignored. The
+// records are only returned if the journal header matches the cache file checksum.
+func readJournal(path string, fileSHA [32]byte) (journal, error) {
+	var j journal
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return j, nil
+	}
+	if err != nil {
+		return j, err
+	}
+	b = b[:bytes.LastIndexByte(b, '\n')+1]
+	j.size = int64(len(b))
+	header, rest, _ := bytes.Cut(b, []byte("\n"))
+	if !bytes.Equal(header, append(append([]byte{}, journalMagic...), hex.EncodeToString(fileSHA[:])...)) {
+		return j, nil
+	}
+	j.valid = true
+	for _, line := range bytes.Split(rest, []byte("\n")) {
+		if len(line) > 0 {
+			j.records = append(j.records, line)
+		}
+	}
+	return j, nil
+}
+
+// applyJournal applies JSON merge patch records to JSON document doc.
+func applyJournal(doc []byte, records [][]byte) ([]byte, error) {
+	target, err := decodeJSON(doc)
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		patch, err := decodeJSON(record)
+		if err != nil {
+			return nil, err
+		}
+		target = applyMergePatch(target, patch)
+	}
+	return json.Marshal(target)
+}
+
+// diffJSON returns a JSON merge patch that converts JSON document original to modified, nil if they are the same.
+func diffJSON(original, modified []byte) ([]byte, error) {
+	o, err := decodeJSON(original)
+	if err != nil {
+		return nil, err
+	}
+	m, err := decodeJSON(modified)
+	if err != nil {
+		return nil, err
+	}
+	if reflect.DeepEqual(o, m) {
+		return nil, nil
+	}
+	return json.Marshal(createMergePatch(o, m))
+}
+
+func decodeJSON(b []byte) (any, error) {
+	var v any
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	err := d.Decode(&v)
+	return v, err
+}
+
+// createMergePatch returns a JSON merge patch that converts original to modified. JSON null values cannot be
+// represented in a merge patch, object members set to null are deleted.
+func createMergePatch(original, modified any) any {
+	o, ok1 := original.(map[string]any)
+	m, ok2 := modified.(map[string]any)
+	if !ok1 || !ok2 {
+		return modified
+	}
+	patch := make(map[string]any)
+	for k := range o {
+		if _, ok := m[k]; !ok {
+			patch[k] = nil
+		}
+	}
+	for k, v := range m {
+		if ov, ok := o[k]; !ok || !reflect.DeepEqual(ov, v) {
+			patch[k] = createMergePatch(ov, v)
+		}
+	}
+	return patch
+}
+
+// applyMergePatch implements the RFC 7386 JSON merge patch algorithm.
+func applyMergePatch(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = make(map[string]any)
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+		} else {
+			t[k] = applyMergePatch(t[k], v)
+		}
+	}
+	return t
+}
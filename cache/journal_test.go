@@ -0,0 +1,182 @@
+package cache
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/srackham/go-utils/assert"
+	"github.com/srackham/go-utils/fsx"
+)
+
+func loadRates(t *testing.T, file string) RatesCache {
+	t.Helper()
+	data := make(RatesCache)
+	c := New(&data)
+	c.CacheFile = file
+	err := c.Load()
+	assert.PassIf(t, err == nil, "%v", err)
+	return data
+}
+
+func TestJournal(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "valuations.json")
+	data := RatesCache{"2022-06-01": Rates{"USD": 1.00, "EUR": 1.07}}
+	c := New(&data)
+	c.CacheFile = file
+	c.Journal = true
+	err := c.Save() // The first save writes the cache file.
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.False(t, fsx.FileExists(c.JournalPath()))
+	snapshot, _ := fsx.ReadFile(file)
+
+	data["2022-06-02"] = Rates{"USD": 1.00}
+	err = c.Save()
+	assert.PassIf(t, err == nil, "%v", err)
+	delete(data["2022-06-01"], "EUR")
+	err = c.Save()
+	assert.PassIf(t, err == nil, "%v", err)
+	err = c.Save() // Unchanged data is not journaled.
+	assert.PassIf(t, err == nil, "%v", err)
+	s, _ := fsx.ReadFile(file)
+	assert.EqualStrings(t, snapshot, s)
+	journal, _ := fsx.ReadFile(c.JournalPath())
+	lines := strings.Split(strings.TrimSuffix(journal, "\n"), "\n")
+	assert.Equal(t, 3, len(lines))
+	assert.EqualStrings(t, `{"2022-06-02":{"USD":1}}`, lines[1])
+	assert.EqualStrings(t, `{"2022-06-01":{"EUR":null}}`, lines[2])
+
+	// Load applies the journal whether or not journal mode is set.
+	loaded := loadRates(t, file)
+	assert.PassIf(t, reflect.DeepEqual(data, loaded), "expected:\n%v\n\ngot:\n%v", data, loaded)
+
+	// A journal left by an interrupted append is truncated to its last complete record.
+	err = fsx.AppendFile(c.JournalPath(), `{"2022-06-03":{"U`)
+	assert.PassIf(t, err == nil, "%v", err)
+	loaded = loadRates(t, file)
+	assert.PassIf(t, reflect.DeepEqual(data, loaded), "expected:\n%v\n\ngot:\n%v", data, loaded)
+	data["2022-06-03"] = Rates{"USD": 3.00}
+	err = c.Save()
+	assert.PassIf(t, err == nil, "%v", err)
+	loaded = loadRates(t, file)
+	assert.PassIf(t, reflect.DeepEqual(data, loaded), "expected:\n%v\n\ngot:\n%v", data, loaded)
+
+	// Compact rewrites the cache file and removes the journal.
+	err = c.Compact()
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.False(t, fsx.FileExists(c.JournalPath()))
+	loaded = loadRates(t, file)
+	assert.PassIf(t, reflect.DeepEqual(data, loaded), "expected:\n%v\n\ngot:\n%v", data, loaded)
+}
+
+func TestJournalConflict(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "valuations.json")
+	data1 := RatesCache{"2022-06-01": Rates{"USD": 1.00}}
+	c1 := New(&data1)
+	c1.CacheFile = file
+	c1.Journal = true
+	err := c1.Save()
+	assert.PassIf(t, err == nil, "%v", err)
+
+	data2 := make(RatesCache)
+	c2 := New(&data2)
+	c2.CacheFile = file
+	c2.Journal = true
+	err = c2.Load()
+	assert.PassIf(t, err == nil, "%v", err)
+	data2["2022-06-02"] = Rates{"USD": 2.00}
+	err = c2.Save()
+	assert.PassIf(t, err == nil, "%v", err)
+
+	data1["2022-06-03"] = Rates{"USD": 3.00}
+	err = c1.Save()
+	assert.PassIf(t, errors.Is(err, ErrConflict), "expected ErrConflict: %v", err)
+	err = c1.Compact()
+	assert.PassIf(t, errors.Is(err, ErrConflict), "expected ErrConflict: %v", err)
+
+	c1.Merge = func(onDisk, inMemory *RatesCache) error {
+		for k, v := range *onDisk {
+			(*inMemory)[k] = v
+		}
+		return nil
+	}
+	err = c1.Save()
+	assert.PassIf(t, err == nil, "%v", err)
+	loaded := loadRates(t, file)
+	assert.Equal(t, 3, len(loaded))
+
+	// A full save by a cache that is not in journal mode discards the journal.
+	err = c2.Load()
+	assert.PassIf(t, err == nil, "%v", err)
+	c2.Journal = false
+	data2["2022-06-04"] = Rates{"USD": 4.00}
+	err = c2.Save()
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.False(t, fsx.FileExists(c2.JournalPath()))
+	loaded = loadRates(t, file)
+	assert.Equal(t, 4, len(loaded))
+}
+
+func TestJournalStale(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "valuations.json")
+	data := RatesCache{"2022-06-01": Rates{"USD": 1.00}}
+	c := New(&data)
+	c.CacheFile = file
+	c.Journal = true
+	err := c.Save()
+	assert.PassIf(t, err == nil, "%v", err)
+	data["2022-06-01"]["USD"] = 2.00
+	err = c.Save()
+	assert.PassIf(t, err == nil, "%v", err)
+	journal, _ := os.ReadFile(c.JournalPath())
+
+	// A journal that belongs to a previous cache file is ignored.
+	err = c.Compact()
+	assert.PassIf(t, err == nil, "%v", err)
+	err = os.WriteFile(c.JournalPath(), []byte(strings.Replace(string(journal), `"USD":2`, `"USD":5`, 1)), 0644)
+	assert.PassIf(t, err == nil, "%v", err)
+	loaded := loadRates(t, file)
+	assert.Equal(t, 2.00, loaded["2022-06-01"]["USD"])
+}
+
+func TestJournalOptions(t *testing.T) {
+	data := RatesCache{"2022-06-01": Rates{"USD": 1.00}}
+	c := New(&data)
+	c.CacheFile = filepath.Join(t.TempDir(), "valuations.gob")
+	c.Journal = true
+	c.Codec = Gob
+	err := c.Save()
+	assert.PassIf(t, err != nil, "expected journal codec error")
+	c.Codec = CompactJSON
+	c.Key = KeyFromPassphrase("secret", nil)
+	err = c.Save()
+	assert.PassIf(t, err != nil, "expected journal encryption error")
+	c.Key = nil
+	c.TTL = time.Hour
+	err = c.Save()
+	assert.PassIf(t, err != nil, "expected journal TTL error")
+}
+
+func TestMergePatch(t *testing.T) {
+	for _, tc := range []struct {
+		original, modified string
+	}{
+		{`{"a":1,"b":{"c":2,"d":3}}`, `{"a":1,"b":{"c":4}}`},
+		{`{"a":[1,2]}`, `{"a":[1,3],"e":{"f":"g"}}`},
+		{`{"a":1}`, `[1,2]`},
+		{`{"a":1.5e300}`, `{"a":12345678901234567890}`},
+	} {
+		patch, err := diffJSON([]byte(tc.original), []byte(tc.modified))
+		assert.PassIf(t, err == nil, "%v", err)
+		got, err := applyJournal([]byte(tc.original), [][]byte{patch})
+		assert.PassIf(t, err == nil, "%v", err)
+		want, _ := applyJournal([]byte(tc.modified), nil)
+		assert.EqualStrings(t, string(want), string(got))
+	}
+	patch, err := diffJSON([]byte(`{"a":1}`), []byte(`{ "a": 1 }`))
+	assert.PassIf(t, err == nil && patch == nil, "unexpected patch: %v", string(patch))
+}
@@ -0,0 +1,259 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// KeyedCache is a goroutine-safe in-memory key/value cache with least recently used (LRU) eviction and per-entry
+// expiry. It can be persisted to a cache file using the Cache Load and Save machinery (see Persist).
+// The exported fields configure GetOrLoad and should be set before the cache is used. The zero value is an unlimited
+// cache whose entries never expire.
+type KeyedCache[K comparable, V any] struct {
+	NegativeTTL time.Duration // Time GetOrLoad caches loader errors, zero does not cache errors.
+	StaleTTL    time.Duration // Time after expiry that GetOrLoad returns stale values while they are refreshed.
+	mu          sync.Mutex
+	maxEntries  int                 // Maximum number of entries, zero is unlimited.
+	ttl         time.Duration       // Default entry time-to-live, zero never expires.
+	ll          list.List           // Entries ordered from most to least recently used.
+	items       map[K]*list.Element // Entry list elements keyed by entry key.
+	stats       Stats
+	storeMu     sync.Mutex                 // Serializes Load and Save.
+	store       *Cache[[]KeyedEntry[K, V]] // Persistent storage.
+	snapshot    []KeyedEntry[K, V]         // Persistent storage cache data.
+	calls       map[K]*loadCall[V]         // In-flight GetOrLoad loader calls.
+	negative    map[K]negativeEntry        // Cached GetOrLoad loader errors.
+	now         func() time.Time           // Current time source, time.Now if nil.
+}
+
+// KeyedEntry is a KeyedCache entry as it is persisted to the cache file.
+type KeyedEntry[K comparable, V any] struct {
+	Key     K
+	Value   V
+	Expires time.Time // Zero if the entry never expires.
+}
+
+// Stats records KeyedCache usage statistics.
+type Stats struct {
+	Hits        uint64
+	Misses      uint64
+	Evictions   uint64 // Entries removed to make room for new entries.
+	Expirations uint64 // Expired entries removed.
+	StaleHits   uint64 // Stale values returned by GetOrLoad.
+	Loads       uint64 // GetOrLoad loader calls.
+}
+
+// NewKeyed returns a KeyedCache that holds at most maxEntries entries (zero or less is unlimited) and whose entries
+// expire ttl after they are set (zero or less never expires).
+func NewKeyed[K comparable, V any](maxEntries int, ttl time.Duration) *KeyedCache[K, V] {
+	return &KeyedCache[K, V]{
+		maxEntries: maxEntries,
+		ttl:        ttl,
+	}
+}
+
+// Get returns the value for key and true, or the zero value and false if key is not cached or has expired.
+// Get marks the entry as the most recently used.
+func (kc *KeyedCache[K, V]) Get(key K) (V, bool) {
+	kc.mu.Lock()
+	defer kc.mu.Unlock()
+	if el, ok := kc.items[key]; ok {
+		e := el.Value.(*KeyedEntry[K, V])
+		if !kc.expired(e) {
+			kc.ll.MoveToFront(el)
+			kc.stats.Hits++
+			return e.Value, true
+		}
+		if !kc.stale(e) {
+			kc.removeElement(el)
+			kc.stats.Expirations++
+		}
+	}
+	kc.stats.Misses++
+	var zero V
+	return zero, false
+}
+
+// Set adds or replaces the value for key using the cache's default TTL.
+func (kc *KeyedCache[K, V]) Set(key K, value V) {
+	kc.SetWithTTL(key, value, kc.ttl)
+}
+
+// SetWithTTL adds or replaces the value for key, the entry expires after ttl (zero or less never expires).
+// If the cache is full the least recently used entry is evicted.
+func (kc *KeyedCache[K, V]) SetWithTTL(key K, value V, ttl time.Duration) {
+	kc.mu.Lock()
+	defer kc.mu.Unlock()
+	var expires time.Time
+	if ttl > 0 {
+		expires = kc.currentTime().Add(ttl)
+	}
+	kc.set(KeyedEntry[K, V]{Key: key, Value: value, Expires: expires})
+}
+
+func (kc *KeyedCache[K, V]) set(e KeyedEntry[K, V]) {
+	if el, ok := kc.items[e.Key]; ok {
+		*el.Value.(*KeyedEntry[K, V]) = e
+		kc.ll.MoveToFront(el)
+		return
+	}
+	if kc.items == nil {
+		kc.items = make(map[K]*list.Element)
+	}
+	kc.items[e.Key] = kc.ll.PushFront(&e)
+	if kc.maxEntries > 0 && kc.ll.Len() > kc.maxEntries {
+		kc.removeElement(kc.ll.Back())
+		kc.stats.Evictions++
+	}
+}
+
+// Delete removes key, and any cached loader error for key, from the cache and returns true if key was present.
+func (kc *KeyedCache[K, V]) Delete(key K) bool {
+	kc.mu.Lock()
+	defer kc.mu.Unlock()
+	delete(kc.negative, key)
+	el, ok := kc.items[key]
+	if ok {
+		kc.removeElement(el)
+	}
+	return ok
+}
+
+// Len returns the number of cached entries, including expired entries that have not yet been removed.
+func (kc *KeyedCache[K, V]) Len() int {
+	kc.mu.Lock()
+	defer kc.mu.Unlock()
+	return kc.ll.Len()
+}
+
+// Keys returns the keys of unexpired entries ordered from most to least recently used.
+func (kc *KeyedCache[K, V]) Keys() []K {
+	kc.mu.Lock()
+	defer kc.mu.Unlock()
+	keys := make([]K, 0, kc.ll.Len())
+	for el := kc.ll.Front(); el != nil; el = el.Next() {
+		if e := el.Value.(*KeyedEntry[K, V]); !kc.expired(e) {
+			keys = append(keys, e.Key)
+		}
+	}
+	return keys
+}
+
+// RemoveExpired removes expired entries, other than stale entries (see GetOrLoad), and returns the number removed.
+func (kc *KeyedCache[K, V]) RemoveExpired() int {
+	kc.mu.Lock()
+	defer kc.mu.Unlock()
+	n := 0
+	for el := kc.ll.Front(); el != nil; {
+		next := el.Next()
+		if e := el.Value.(*KeyedEntry[K, V]); kc.expired(e) && !kc.stale(e) {
+			kc.removeElement(el)
+			n++
+		}
+		el = next
+	}
+	kc.stats.Expirations += uint64(n)
+	return n
+}
+
+// Clear removes all entries and cached loader errors, statistics are not reset.
+func (kc *KeyedCache[K, V]) Clear() {
+	kc.mu.Lock()
+	defer kc.mu.Unlock()
+	kc.ll.Init()
+	kc.items = make(map[K]*list.Element)
+	kc.negative = nil
+}
+
+// Stats returns a copy of the cache usage statistics.
+func (kc *KeyedCache[K, V]) Stats() Stats {
+	kc.mu.Lock()
+	defer kc.mu.Unlock()
+	return kc.stats
+}
+
+// Snapshot returns the unexpired entries ordered from most to least recently used.
+func (kc *KeyedCache[K, V]) Snapshot() []KeyedEntry[K, V] {
+	kc.mu.Lock()
+	defer kc.mu.Unlock()
+	entries := make([]KeyedEntry[K, V], 0, kc.ll.Len())
+	for el := kc.ll.Front(); el != nil; el = el.Next() {
+		if e := el.Value.(*KeyedEntry[K, V]); !kc.expired(e) {
+			entries = append(entries, *e)
+		}
+	}
+	return entries
+}
+
+// Restore replaces the cache contents with entries (ordered from most to least recently used), expired entries are
+// skipped.
+func (kc *KeyedCache[K, V]) Restore(entries []KeyedEntry[K, V]) {
+	kc.mu.Lock()
+	defer kc.mu.Unlock()
+	kc.ll.Init()
+	kc.items = make(map[K]*list.Element)
+	for i := len(entries) - 1; i >= 0; i-- {
+		if !kc.expired(&entries[i]) {
+			kc.set(entries[i])
+		}
+	}
+}
+
+// Persist sets the file used by Load and Save and returns the underlying Cache, which can be used to set persistence
+// options (Codec, Compress etc.).
+func (kc *KeyedCache[K, V]) Persist(file string) *Cache[[]KeyedEntry[K, V]] {
+	kc.storeMu.Lock()
+	defer kc.storeMu.Unlock()
+	kc.store = New(&kc.snapshot)
+	kc.store.CacheFile = file
+	return kc.store
+}
+
+// Load restores the cache from the file set by Persist.
+func (kc *KeyedCache[K, V]) Load() error {
+	kc.storeMu.Lock()
+	defer kc.storeMu.Unlock()
+	if kc.store == nil {
+		return ErrNoCacheFile
+	}
+	kc.snapshot = nil
+	if err := kc.store.Load(); err != nil {
+		return err
+	}
+	kc.Restore(kc.snapshot)
+	return nil
+}
+
+// Save writes a snapshot of the cache to the file set by Persist.
+func (kc *KeyedCache[K, V]) Save() error {
+	kc.storeMu.Lock()
+	defer kc.storeMu.Unlock()
+	if kc.store == nil {
+		return ErrNoCacheFile
+	}
+	kc.snapshot = kc.Snapshot()
+	return kc.store.Save()
+}
+
+func (kc *KeyedCache[K, V]) expired(e *KeyedEntry[K, V]) bool {
+	return !e.Expires.IsZero() && !kc.currentTime().Before(e.Expires)
+}
+
+// stale returns true if entry e has expired but is within the StaleTTL window.
+func (kc *KeyedCache[K, V]) stale(e *KeyedEntry[K, V]) bool {
+	return kc.expired(e) && kc.StaleTTL > 0 && kc.currentTime().Before(e.Expires.Add(kc.StaleTTL))
+}
+
+// currentTime returns the current time.
+func (kc *KeyedCache[K, V]) currentTime() time.Time {
+	if kc.now == nil {
+		return time.Now()
+	}
+	return kc.now()
+}
+
+func (kc *KeyedCache[K, V]) removeElement(el *list.Element) {
+	kc.ll.Remove(el)
+	delete(kc.items, el.Value.(*KeyedEntry[K, V]).Key)
+}
@@ -0,0 +1,155 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/srackham/go-utils/assert"
+)
+
+// fakeClock is a manually advanced clock for testing expiry.
+type fakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (fc *fakeClock) now() time.Time {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.t
+}
+
+func (fc *fakeClock) advance(d time.Duration) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.t = fc.t.Add(d)
+}
+
+func TestKeyedLRU(t *testing.T) {
+	kc := NewKeyed[string, int](3, 0)
+	kc.Set("a", 1)
+	kc.Set("b", 2)
+	kc.Set("c", 3)
+	assert.EqualValues(t, []string{"c", "b", "a"}, kc.Keys())
+	v, ok := kc.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, v)
+	kc.Set("d", 4) // Evicts "b", the least recently used.
+	assert.EqualValues(t, []string{"d", "a", "c"}, kc.Keys())
+	_, ok = kc.Get("b")
+	assert.False(t, ok)
+	kc.Set("c", 30) // Replaces "c".
+	assert.Equal(t, 3, kc.Len())
+	v, _ = kc.Get("c")
+	assert.Equal(t, 30, v)
+	assert.True(t, kc.Delete("c"))
+	assert.False(t, kc.Delete("c"))
+	assert.Equal(t, Stats{Hits: 2, Misses: 1, Evictions: 1}, kc.Stats())
+	kc.Clear()
+	assert.Equal(t, 0, kc.Len())
+}
+
+func TestKeyedZeroValue(t *testing.T) {
+	kc := &KeyedCache[string, int]{StaleTTL: time.Minute}
+	v, ok := kc.Get("a")
+	assert.False(t, ok)
+	kc.Set("a", 1)
+	v, ok = kc.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, v)
+	v, err := kc.GetOrLoad(context.Background(), "b", func(ctx context.Context) (int, error) { return 2, nil })
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.Equal(t, 2, v)
+	assert.EqualValues(t, []string{"b", "a"}, kc.Keys())
+	assert.True(t, kc.Delete("a"))
+	assert.Equal(t, 1, kc.Len())
+}
+
+func TestKeyedTTL(t *testing.T) {
+	clock := &fakeClock{t: time.Now()}
+	kc := NewKeyed[string, int](0, time.Minute)
+	kc.now = clock.now
+	kc.Set("a", 1)
+	kc.SetWithTTL("b", 2, time.Hour)
+	kc.SetWithTTL("c", 3, 0)
+	clock.advance(time.Minute)
+	_, ok := kc.Get("a")
+	assert.False(t, ok)
+	assert.EqualValues(t, []string{"c", "b"}, kc.Keys())
+	clock.advance(time.Hour)
+	assert.Equal(t, 2, kc.Len())
+	assert.Equal(t, 1, kc.RemoveExpired())
+	v, ok := kc.Get("c")
+	assert.True(t, ok)
+	assert.Equal(t, 3, v)
+	assert.Equal(t, Stats{Hits: 1, Misses: 1, Expirations: 2}, kc.Stats())
+}
+
+func TestKeyedPersistence(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "keyed.json")
+	kc := NewKeyed[string, Rates](0, 0)
+	err := kc.Load()
+	assert.PassIf(t, err == ErrNoCacheFile, "expected ErrNoCacheFile: %v", err)
+	kc.Persist(file)
+	kc.Set("2022-06-01", Rates{"USD": 1.00})
+	kc.SetWithTTL("2022-06-02", Rates{"USD": 2.00}, time.Hour)
+	kc.SetWithTTL("2022-06-03", Rates{"USD": 3.00}, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	err = kc.Save()
+	assert.PassIf(t, err == nil, "%v", err)
+
+	kc2 := NewKeyed[string, Rates](0, 0)
+	kc2.Persist(file).Compress = true
+	err = kc2.Load()
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.EqualValues(t, []string{"2022-06-02", "2022-06-01"}, kc2.Keys())
+	v, _ := kc2.Get("2022-06-02")
+	assert.Equal(t, 2.00, v["USD"])
+
+	// Unchanged entries are not rewritten.
+	info, _ := os.Stat(file)
+	os.Chtimes(file, time.Time{}, info.ModTime().Add(-time.Hour))
+	err = kc.Save()
+	assert.PassIf(t, err == nil, "%v", err)
+	info2, _ := os.Stat(file)
+	assert.Equal(t, info.ModTime().Add(-time.Hour), info2.ModTime())
+
+	// A cache that was not loaded after a restart replaces the existing file.
+	kc3 := NewKeyed[string, Rates](0, 0)
+	kc3.Persist(file)
+	kc3.Set("2022-06-04", Rates{"USD": 4.00})
+	err = kc3.Save()
+	assert.PassIf(t, err == nil, "%v", err)
+}
+
+func TestKeyedConcurrency(t *testing.T) {
+	kc := NewKeyed[int, string](50, time.Minute)
+	kc.Persist(filepath.Join(t.TempDir(), "keyed.json"))
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range 100 {
+				k := (i*100 + j) % 80
+				kc.Set(k, fmt.Sprint(k))
+				if v, ok := kc.Get(k); ok && v != fmt.Sprint(k) {
+					t.Errorf("Get(%d) returned: %q", k, v)
+				}
+				if j%25 == 0 {
+					if err := kc.Save(); err != nil {
+						t.Errorf("Save failed with error: %v", err)
+					}
+				}
+				kc.Keys()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 50, kc.Len())
+}
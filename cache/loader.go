@@ -0,0 +1,150 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Loader loads the value for a KeyedCache key, see KeyedCache.GetOrLoad.
+type Loader[V any] func(ctx context.Context) (V, error)
+
+// loadCall is an in-flight or completed Loader call.
+type loadCall[V any] struct {
+	done      chan struct{} // Closed when the call has completed.
+	value     V
+	err       error
+	cancelled bool // The call failed after the caller's context was cancelled.
+}
+
+// negativeEntry is a cached Loader error.
+type negativeEntry struct {
+	err     error
+	expires time.Time
+}
+
+// GetOrLoad returns the cached value for key. If key is not cached, or has expired, it calls loader to load the value
+// and caches the result. Concurrent calls for the same key share a single loader call.
+//
+// If NegativeTTL is set then loader errors are cached and returned, without calling loader, until they expire. If
+// StaleTTL is set then, for StaleTTL after an entry expires, GetOrLoad returns the stale value immediately and
+// refreshes it in the background, unless a cached loader error has not expired; the background refresh is not
+// cancelled when ctx is.
+//
+// ctx is passed to loader and, if it is cancelled while waiting for another goroutine's loader call, GetOrLoad returns
+// the context error. If the goroutine whose ctx was passed to loader is cancelled then the goroutines waiting for its
+// call call loader again. Context errors are not cached.
+func (kc *KeyedCache[K, V]) GetOrLoad(ctx context.Context, key K, loader Loader[V]) (V, error) {
+	kc.mu.Lock()
+	if el, ok := kc.items[key]; ok {
+		e := el.Value.(*KeyedEntry[K, V])
+		value := e.Value
+		switch {
+		case !kc.expired(e):
+			kc.ll.MoveToFront(el)
+			kc.stats.Hits++
+			kc.mu.Unlock()
+			return value, nil
+		case kc.stale(e):
+			kc.ll.MoveToFront(el)
+			kc.stats.StaleHits++
+			// A cached loader error suppresses refreshes until it expires.
+			if _, ok := kc.calls[key]; !ok && !kc.negativeCached(key) {
+				call := kc.startLoad(key)
+				go kc.runLoad(context.WithoutCancel(ctx), key, call, loader)
+			}
+			kc.mu.Unlock()
+			return value, nil
+		default:
+			kc.removeElement(el)
+			kc.stats.Expirations++
+		}
+	}
+	if kc.negativeCached(key) {
+		err := kc.negative[key].err
+		kc.stats.Hits++
+		kc.mu.Unlock()
+		var zero V
+		return zero, err
+	}
+	kc.stats.Misses++
+	call, ok := kc.calls[key]
+	if !ok {
+		call = kc.startLoad(key)
+		kc.mu.Unlock()
+		kc.runLoad(ctx, key, call, loader)
+	} else {
+		kc.mu.Unlock()
+	}
+	select {
+	case <-call.done:
+		if call.cancelled && ctx.Err() == nil {
+			// Another caller's cancellation does not fail this call.
+			return kc.GetOrLoad(ctx, key, loader)
+		}
+		return call.value, call.err
+	case <-ctx.Done():
+		var zero V
+		return zero, ctx.Err()
+	}
+}
+
+// negativeCached returns true if there is an unexpired cached loader error for key, expired errors are removed. The
+// caller must hold the lock.
+func (kc *KeyedCache[K, V]) negativeCached(key K) bool {
+	ne, ok := kc.negative[key]
+	if ok && !kc.currentTime().Before(ne.expires) {
+		delete(kc.negative, key)
+		return false
+	}
+	return ok
+}
+
+// startLoad registers an in-flight loader call for key, the caller must hold the lock.
+func (kc *KeyedCache[K, V]) startLoad(key K) *loadCall[V] {
+	if kc.calls == nil {
+		kc.calls = make(map[K]*loadCall[V])
+	}
+	call := &loadCall[V]{done: make(chan struct{})}
+	kc.calls[key] = call
+	kc.stats.Loads++
+	return call
+}
+
+// runLoad calls loader, caches the result and then completes the call.
+func (kc *KeyedCache[K, V]) runLoad(ctx context.Context, key K, call *loadCall[V], loader Loader[V]) {
+	defer func() {
+		r := recover()
+		if r != nil {
+			call.err = fmt.Errorf("cache: loader panic: %v", r)
+		}
+		call.cancelled = call.err != nil && ctx.Err() != nil
+		kc.mu.Lock()
+		delete(kc.calls, key)
+		if call.err == nil {
+			var expires time.Time
+			if kc.ttl > 0 {
+				expires = kc.currentTime().Add(kc.ttl)
+			}
+			kc.set(KeyedEntry[K, V]{Key: key, Value: call.value, Expires: expires})
+			delete(kc.negative, key)
+		} else if kc.NegativeTTL > 0 && !call.cancelled && !isContextError(call.err) {
+			if kc.negative == nil {
+				kc.negative = make(map[K]negativeEntry)
+			}
+			kc.negative[key] = negativeEntry{err: call.err, expires: kc.currentTime().Add(kc.NegativeTTL)}
+		}
+		kc.mu.Unlock()
+		close(call.done)
+		if r != nil {
+			panic(r)
+		}
+	}()
+	call.value, call.err = loader(ctx)
+}
+
+// isContextError returns true if err is a context cancellation or deadline error.
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
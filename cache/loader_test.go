@@ -0,0 +1,218 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/srackham/go-utils/assert"
+)
+
+func TestGetOrLoadDeduplicates(t *testing.T) {
+	kc := NewKeyed[string, float64](0, 0)
+	var calls atomic.Int32
+	release := make(chan struct{})
+	loader := func(ctx context.Context) (float64, error) {
+		calls.Add(1)
+		<-release
+		return 1.07, nil
+	}
+	var wg sync.WaitGroup
+	results := make(chan float64, 10)
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := kc.GetOrLoad(context.Background(), "EUR", loader)
+			if err != nil {
+				t.Errorf("GetOrLoad failed with error: %v", err)
+			}
+			results <- v
+		}()
+	}
+	for kc.Stats().Misses < 10 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+	close(results)
+	for v := range results {
+		assert.Equal(t, 1.07, v)
+	}
+	assert.Equal(t, int32(1), calls.Load())
+	v, err := kc.GetOrLoad(context.Background(), "EUR", loader)
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.Equal(t, 1.07, v)
+	assert.Equal(t, int32(1), calls.Load())
+	assert.Equal(t, Stats{Hits: 1, Misses: 10, Loads: 1}, kc.Stats())
+}
+
+func TestGetOrLoadErrors(t *testing.T) {
+	clock := &fakeClock{t: time.Now()}
+	kc := NewKeyed[string, float64](0, 0)
+	kc.now = clock.now
+	var calls int
+	failing := func(ctx context.Context) (float64, error) {
+		calls++
+		return 0, errors.New("rate unavailable")
+	}
+	_, err := kc.GetOrLoad(context.Background(), "EUR", failing)
+	assert.PassIf(t, err != nil, "expected error")
+	_, err = kc.GetOrLoad(context.Background(), "EUR", failing)
+	assert.PassIf(t, err != nil, "expected error")
+	assert.Equal(t, 2, calls) // Errors are not cached by default.
+
+	kc.NegativeTTL = time.Minute
+	_, err = kc.GetOrLoad(context.Background(), "EUR", failing)
+	assert.PassIf(t, err != nil, "expected error")
+	_, err = kc.GetOrLoad(context.Background(), "EUR", failing)
+	assert.PassIf(t, err != nil && err.Error() == "rate unavailable", "%v", err)
+	assert.Equal(t, 3, calls)
+	clock.advance(time.Minute)
+	_, err = kc.GetOrLoad(context.Background(), "EUR", failing)
+	assert.PassIf(t, err != nil, "expected error")
+	assert.Equal(t, 4, calls)
+	kc.Delete("EUR")
+	v, err := kc.GetOrLoad(context.Background(), "EUR", func(ctx context.Context) (float64, error) { return 1.07, nil })
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.Equal(t, 1.07, v)
+
+	assert.Panics(t, func() {
+		kc.GetOrLoad(context.Background(), "NZD", func(ctx context.Context) (float64, error) { panic("boom") })
+	})
+	_, ok := kc.Get("NZD")
+	assert.False(t, ok)
+}
+
+func TestGetOrLoadStale(t *testing.T) {
+	clock := &fakeClock{t: time.Now()}
+	kc := NewKeyed[string, float64](0, time.Minute)
+	kc.now = clock.now
+	kc.StaleTTL = time.Hour
+	refreshed := make(chan struct{})
+	rate := 1.07
+	loader := func(ctx context.Context) (float64, error) {
+		return rate, nil
+	}
+	v, err := kc.GetOrLoad(context.Background(), "EUR", loader)
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.Equal(t, 1.07, v)
+
+	clock.advance(2 * time.Minute)
+	_, ok := kc.Get("EUR")
+	assert.False(t, ok)
+	assert.Equal(t, 0, kc.RemoveExpired()) // Stale entries are retained.
+	ctx, cancel := context.WithCancel(context.Background())
+	v, err = kc.GetOrLoad(ctx, "EUR", func(ctx context.Context) (float64, error) {
+		defer close(refreshed)
+		return 1.08, nil
+	})
+	cancel() // Does not cancel the background refresh.
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.Equal(t, 1.07, v) // Stale value.
+	<-refreshed
+	for {
+		if v, ok := kc.Get("EUR"); ok {
+			assert.Equal(t, 1.08, v)
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Beyond the stale window the value is loaded synchronously.
+	clock.advance(2 * time.Hour)
+	rate = 1.09
+	v, err = kc.GetOrLoad(context.Background(), "EUR", loader)
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.Equal(t, 1.09, v)
+	assert.Equal(t, uint64(1), kc.Stats().StaleHits)
+	assert.Equal(t, uint64(3), kc.Stats().Loads)
+
+	// Refresh errors are negatively cached, the stale value is returned without calling loader.
+	kc.NegativeTTL = time.Hour
+	clock.advance(2 * time.Minute)
+	var calls atomic.Int32
+	failing := func(ctx context.Context) (float64, error) {
+		calls.Add(1)
+		return 0, errors.New("rate unavailable")
+	}
+	refreshing := func() bool {
+		kc.mu.Lock()
+		defer kc.mu.Unlock()
+		_, ok := kc.calls["EUR"]
+		return ok
+	}
+	for range 20 {
+		v, err = kc.GetOrLoad(context.Background(), "EUR", failing)
+		assert.PassIf(t, err == nil, "%v", err)
+		assert.Equal(t, 1.09, v)
+		for kc.Stats().Loads < 4 || refreshing() {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestGetOrLoadCancel(t *testing.T) {
+	kc := NewKeyed[string, float64](0, 0)
+	release := make(chan struct{})
+	go kc.GetOrLoad(context.Background(), "EUR", func(ctx context.Context) (float64, error) {
+		<-release
+		return 1.07, nil
+	})
+	for kc.Stats().Loads == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := kc.GetOrLoad(ctx, "EUR", func(ctx context.Context) (float64, error) { return 0, nil })
+	assert.PassIf(t, errors.Is(err, context.DeadlineExceeded), "expected context.DeadlineExceeded: %v", err)
+	close(release)
+}
+
+func TestGetOrLoadCancelShared(t *testing.T) {
+	kc := NewKeyed[string, float64](0, 0)
+	kc.NegativeTTL = time.Hour
+	ctx, cancel := context.WithCancel(context.Background())
+	leader := make(chan error)
+	go func() {
+		_, err := kc.GetOrLoad(ctx, "EUR", func(ctx context.Context) (float64, error) {
+			<-ctx.Done()
+			return 0, ctx.Err()
+		})
+		leader <- err
+	}()
+	for kc.Stats().Loads == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	waiter := make(chan float64)
+	go func() {
+		v, err := kc.GetOrLoad(context.Background(), "EUR", func(ctx context.Context) (float64, error) {
+			return 1.07, nil
+		})
+		if err != nil {
+			t.Errorf("GetOrLoad failed with error: %v", err)
+		}
+		waiter <- v
+	}()
+	for kc.Stats().Misses < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	err := <-leader
+	assert.PassIf(t, errors.Is(err, context.Canceled), "expected context.Canceled: %v", err)
+	assert.Equal(t, 1.07, <-waiter) // The waiter loads again instead of failing.
+
+	// Context errors returned by loader are not negatively cached.
+	kc.Delete("EUR")
+	_, err = kc.GetOrLoad(context.Background(), "EUR", func(ctx context.Context) (float64, error) {
+		return 0, context.DeadlineExceeded
+	})
+	assert.PassIf(t, errors.Is(err, context.DeadlineExceeded), "expected context.DeadlineExceeded: %v", err)
+	v, err := kc.GetOrLoad(context.Background(), "EUR", func(ctx context.Context) (float64, error) { return 1.08, nil })
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.Equal(t, 1.08, v)
+}
@@ -0,0 +1,139 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+)
+
+// DefaultLockTimeout is the time spent waiting for the cache file lock when Cache.LockTimeout is zero.
+const DefaultLockTimeout = 10 * time.Second
+
+// lockPollInterval is the time between attempts to acquire a lock held by another process.
+const lockPollInterval = 10 * time.Millisecond
+
+// ErrLockTimeout is wrapped by LockError when the lock is still held by another process after Cache.LockTimeout.
+var ErrLockTimeout = errors.New("timed out waiting for lock")
+
+// LockError is returned when the cache file lock cannot be acquired.
+type LockError struct {
+	Path string // Lock file path.
+	Err  error
+}
+
+func (e *LockError) Error() string {
+	return "cache: cannot lock " + e.Path + ": " + e.Err.Error()
+}
+
+func (e *LockError) Unwrap() error {
+	return e.Err
+}
+
+// LockPath returns the path of the lock file, it sits alongside the cache file.
+func (c *Cache[T]) LockPath() string {
+	return c.CacheFile + ".lock"
+}
+
+// LoadLocked acquires the cache file lock and then loads the cache. The lock is held, and other processes cannot
+// save the cache, until Unlock is called. The lock is released if the load fails.
+func (c *Cache[T]) LoadLocked() error {
+	f, err := c.lock(context.Background(), nil)
+	if err != nil {
+		return err
+	}
+	c.lockMu.Lock()
+	c.lockFile = f
+	c.lockMu.Unlock()
+	err = c.Load()
+	if err != nil {
+		c.Unlock()
+	}
+	return err
+}
+
+// Unlock releases the lock acquired by LoadLocked. It is a no-op if the lock is not held.
+func (c *Cache[T]) Unlock() error {
+	c.lockMu.Lock()
+	f := c.lockFile
+	c.lockFile = nil
+	c.lockMu.Unlock()
+	if f == nil {
+		return nil
+	}
+	return unlockFile(f)
+}
+
+// WithLock loads the cache, calls f and then saves the cache, holding the cache file lock throughout.
+// The cache is not saved if f returns an error.
+func (c *Cache[T]) WithLock(f func() error) error {
+	if err := c.LoadLocked(); err != nil {
+		return err
+	}
+	defer c.Unlock()
+	if err := f(); err != nil {
+		return err
+	}
+	return c.Save()
+}
+
+// lockIfUnlocked acquires the cache file lock if it is not already held by LoadLocked and returns a function that
+// releases it. A lock held by LoadLocked cannot be released by Unlock until the returned function is called.
+func (c *Cache[T]) lockIfUnlocked(ctx context.Context) (func(), error) {
+	if c.holdLock() {
+		return c.lockMu.Unlock, nil
+	}
+	f, err := c.lock(ctx, c.holdLock)
+	if err != nil {
+		return nil, err
+	}
+	if f == nil {
+		return c.lockMu.Unlock, nil // LoadLocked acquired the lock while we were waiting.
+	}
+	return func() { unlockFile(f) }, nil
+}
+
+// holdLock returns true, with lockMu locked, if the cache file lock is held by LoadLocked.
+func (c *Cache[T]) holdLock() bool {
+	c.lockMu.Lock()
+	if c.lockFile != nil {
+		return true
+	}
+	c.lockMu.Unlock()
+	return false
+}
+
+// lock acquires the cache file lock, polling until it is released by other processes or Cache.LockTimeout expires.
+// A negative LockTimeout fails immediately if the lock is held. Waiting stops if ctx is cancelled, or if held is not
+// nil and returns true, in which case a nil file is returned.
+func (c *Cache[T]) lock(ctx context.Context, held func() bool) (*os.File, error) {
+	if c.CacheFile == "" {
+		return nil, ErrNoCacheFile
+	}
+	path := c.LockPath()
+	timeout := c.LockTimeout
+	if timeout == 0 {
+		timeout = DefaultLockTimeout
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		f, err := tryLockFile(path)
+		if err != nil {
+			return nil, &LockError{Path: path, Err: err}
+		}
+		if f != nil {
+			return f, nil
+		}
+		if held != nil && held() {
+			return nil, nil
+		}
+		if !time.Now().Before(deadline) {
+			return nil, &LockError{Path: path, Err: ErrLockTimeout}
+		}
+		select {
+		case <-ctx.Done():
+			return nil, &LockError{Path: path, Err: ctx.Err()}
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
@@ -0,0 +1,29 @@
+//go:build !unix
+
+package cache
+
+import (
+	"errors"
+	"os"
+)
+
+// tryLockFile exclusively creates the lock file. It returns a nil file if the lock file already exists i.e. the lock
+// is held by another process. A lock file left behind by a crashed process must be removed manually.
+func tryLockFile(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return f, nil
+}
+
+func unlockFile(f *os.File) error {
+	err := f.Close()
+	if rerr := os.Remove(f.Name()); err == nil {
+		err = rerr
+	}
+	return err
+}
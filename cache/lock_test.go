@@ -0,0 +1,139 @@
+package cache
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/srackham/go-utils/assert"
+)
+
+type Counter struct {
+	Count int
+}
+
+func TestLock(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "counter.json")
+	var data1, data2 Counter
+	c1 := New(&data1)
+	c1.CacheFile = file
+	c2 := New(&data2)
+	c2.CacheFile = file
+	c2.LockTimeout = 50 * time.Millisecond
+
+	err := c1.LoadLocked()
+	assert.PassIf(t, err == nil, "%v", err)
+	data1.Count = 1
+	err = c1.Save() // Save uses the lock already held by c1.
+	assert.PassIf(t, err == nil, "%v", err)
+
+	err = c2.LoadLocked()
+	var lockErr *LockError
+	assert.PassIf(t, errors.As(err, &lockErr), "expected *LockError: %v", err)
+	assert.Equal(t, c1.LockPath(), lockErr.Path)
+	assert.PassIf(t, errors.Is(err, ErrLockTimeout), "expected ErrLockTimeout: %v", err)
+	data2.Count = 2
+	err = c2.Save()
+	assert.PassIf(t, errors.Is(err, ErrLockTimeout), "expected ErrLockTimeout: %v", err)
+
+	err = c1.Unlock()
+	assert.PassIf(t, err == nil, "%v", err)
+	err = c1.Unlock()
+	assert.PassIf(t, err == nil, "%v", err)
+	err = c2.LoadLocked()
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.Equal(t, 1, data2.Count)
+	err = c2.Unlock()
+	assert.PassIf(t, err == nil, "%v", err)
+}
+
+func TestWithLock(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "counter.json")
+	const workers, increments = 4, 25
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*increments)
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Each worker has its own Cache, just like separate processes would.
+			var data Counter
+			c := New(&data)
+			c.CacheFile = file
+			for range increments {
+				errs <- c.WithLock(func() error {
+					data.Count++
+					return nil
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		assert.PassIf(t, err == nil, "%v", err)
+	}
+	var data Counter
+	c := New(&data)
+	c.CacheFile = file
+	err := c.Load()
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.Equal(t, workers*increments, data.Count)
+
+	// The cache is not saved if the function fails.
+	err = c.WithLock(func() error {
+		data.Count = 0
+		return errors.New("failed")
+	})
+	assert.PassIf(t, err != nil, "expected error")
+	err = c.Load()
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.Equal(t, workers*increments, data.Count)
+}
+
+// TestWithLockConcurrentSave checks, when run with -race, that LoadLocked, Unlock and Save are synchronized.
+func TestWithLockConcurrentSave(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "counter.json")
+	var data Counter
+	c := New(&data)
+	c.CacheFile = file
+	const increments = 25
+	var wg sync.WaitGroup
+	errs := make(chan error, 3*increments)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for range increments {
+			errs <- c.WithLock(func() error {
+				return c.Update(func(data *Counter) error {
+					data.Count++
+					return nil
+				})
+			})
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for range increments {
+			errs <- c.Update(func(data *Counter) error {
+				data.Count++
+				return nil
+			})
+			errs <- c.Save()
+		}
+	}()
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		assert.PassIf(t, err == nil, "%v", err)
+	}
+	var data2 Counter
+	c2 := New(&data2)
+	c2.CacheFile = file
+	err := c2.Load()
+	assert.PassIf(t, err == nil, "%v", err)
+	// LoadLocked reloads the cache file so unsaved increments made by the other goroutine can be lost.
+	assert.PassIf(t, data2.Count > 0 && data2.Count <= 2*increments, "unexpected count: %d", data2.Count)
+}
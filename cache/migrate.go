@@ -0,0 +1,54 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Migration converts encoded cache data from one schema version to the next. The data is encoded with the cache's
+// Codec so for the JSON codecs it is raw JSON.
+type Migration func(data []byte) ([]byte, error)
+
+// MapMigration returns a Migration for JSON encoded cache data that is a JSON object. The object is decoded to a map
+// which is updated in place by f.
+func MapMigration(f func(m map[string]any) error) Migration {
+	return func(data []byte) ([]byte, error) {
+		m := make(map[string]any)
+		if err := json.Unmarshal(data, &m); err != nil {
+			return nil, err
+		}
+		if err := f(m); err != nil {
+			return nil, err
+		}
+		return json.Marshal(m)
+	}
+}
+
+// VersionError is returned by Load when the cache file was saved by a program that supports a newer schema version.
+type VersionError struct {
+	Path    string // Cache file path.
+	Version int    // Cache file schema version.
+	Current int    // Cache.Version.
+}
+
+func (e *VersionError) Error() string {
+	return fmt.Sprintf("cache: %s: schema version %d is newer than supported version %d", e.Path, e.Version, e.Current)
+}
+
+// migrate runs the migrations needed to bring data saved with the envelope's schema version up to Cache.Version.
+func (c *Cache[T]) migrate(env envelope, data []byte) ([]byte, error) {
+	if env.Version > c.Version {
+		return nil, &VersionError{Path: c.CacheFile, Version: env.Version, Current: c.Version}
+	}
+	for v := env.Version; v < c.Version; v++ {
+		m := c.Migrations[v]
+		if m == nil {
+			return nil, fmt.Errorf("cache: %s: no migration from schema version %d", c.CacheFile, v)
+		}
+		var err error
+		if data, err = m(data); err != nil {
+			return nil, fmt.Errorf("cache: %s: migration from schema version %d: %w", c.CacheFile, v, err)
+		}
+	}
+	return data, nil
+}
@@ -0,0 +1,80 @@
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/srackham/go-utils/assert"
+)
+
+type Person struct {
+	First string
+	Last  string
+	Age   int
+}
+
+func TestMigrations(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "person.json")
+	// Version 0 cache file (no envelope).
+	err := os.WriteFile(file, []byte(`{"Fullname": "Joe Bloggs"}`), 0644)
+	assert.PassIf(t, err == nil, "%v", err)
+
+	var data Person
+	c := New(&data)
+	c.CacheFile = file
+	c.Version = 2
+	c.Migrations = map[int]Migration{
+		0: MapMigration(func(m map[string]any) error {
+			first, last, _ := strings.Cut(m["Fullname"].(string), " ")
+			m["First"], m["Last"] = first, last
+			delete(m, "Fullname")
+			return nil
+		}),
+		1: func(data []byte) ([]byte, error) {
+			return bytes.Replace(data, []byte("{"), []byte(`{"Age":42,`), 1), nil
+		},
+	}
+	err = c.Load()
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.Equal(t, Person{First: "Joe", Last: "Bloggs", Age: 42}, data)
+
+	// Migrated data is saved with the current version even though it has not been modified since it was loaded.
+	err = c.Save()
+	assert.PassIf(t, err == nil, "%v", err)
+	b, _ := os.ReadFile(file)
+	env, _, err := unwrap(b)
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.Equal(t, 2, env.Version)
+	data = Person{}
+	err = c.Load()
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.Equal(t, Person{First: "Joe", Last: "Bloggs", Age: 42}, data)
+	assert.NotEqual(t, [32]byte{}, c.sha256)
+
+	// Cache files with a newer version cannot be loaded.
+	var old Person
+	c2 := New(&old)
+	c2.CacheFile = file
+	c2.Version = 1
+	err = c2.Load()
+	var versionErr *VersionError
+	assert.PassIf(t, errors.As(err, &versionErr), "expected *VersionError: %v", err)
+	assert.Equal(t, VersionError{Path: file, Version: 2, Current: 1}, *versionErr)
+	assert.Equal(t, Person{}, old)
+
+	// Missing and failed migrations.
+	c2.Version = 4
+	err = c2.Load()
+	assert.PassIf(t, err != nil && strings.Contains(err.Error(), "no migration from schema version 2"), "%v", err)
+	c2.Migrations = map[int]Migration{
+		2: func(data []byte) ([]byte, error) { return data, nil },
+		3: func(data []byte) ([]byte, error) { return nil, errors.New("failed") },
+	}
+	err = c2.Load()
+	assert.PassIf(t, err != nil && strings.Contains(err.Error(), "migration from schema version 3: failed"), "%v", err)
+	assert.Equal(t, Person{}, old)
+}
@@ -0,0 +1,195 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"time"
+
+	"github.com/srackham/go-utils/fsx"
+)
+
+// ErrTooLarge is returned by Load when the cache file, or its decompressed contents, exceeds Cache.MaxSize.
+var ErrTooLarge = errors.New("cache: cache file exceeds Cache.MaxSize")
+
+// errNoStream is returned by loadStream when the cache file must be loaded by load.
+var errNoStream = errors.New("cache: cache file cannot be streamed")
+
+// fileReader reads the cache file, it reports progress and stops reading when its context is cancelled.
+type fileReader struct {
+	ctx      context.Context
+	r        io.Reader
+	n        int64 // Bytes read.
+	size     int64 // File size.
+	progress func(read, size int64)
+	err      error // The first read error, errors are recorded so they are not mistaken for corrupt data.
+}
+
+func (fr *fileReader) Read(p []byte) (int, error) {
+	if fr.err == nil {
+		fr.err = fr.ctx.Err()
+	}
+	if fr.err != nil {
+		return 0, fr.err
+	}
+	n, err := fr.r.Read(p)
+	fr.n += int64(n)
+	if n > 0 && fr.progress != nil {
+		fr.progress(fr.n, fr.size)
+	}
+	if err != nil && err != io.EOF {
+		fr.err = err
+	}
+	return n, err
+}
+
+// limitReader returns ErrTooLarge once more than max bytes have been read, zero max is unlimited.
+type limitReader struct {
+	r   io.Reader
+	n   int64
+	max int64
+	err error
+}
+
+func (lr *limitReader) Read(p []byte) (int, error) {
+	if lr.err != nil {
+		return 0, lr.err
+	}
+	n, err := lr.r.Read(p)
+	lr.n += int64(n)
+	if lr.max > 0 && lr.n > lr.max {
+		lr.err = ErrTooLarge
+		return n, lr.err
+	}
+	return n, err
+}
+
+// openFile opens file name for reading and returns its file info. ErrTooLarge is returned if the file exceeds MaxSize.
+func (c *Cache[T]) openFile(name string) (*os.File, os.FileInfo, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	if c.MaxSize > 0 && info.Size() > c.MaxSize {
+		f.Close()
+		return nil, nil, ErrTooLarge
+	}
+	return f, info, nil
+}
+
+// readFile returns the contents of file name, it honours MaxSize, Progress and ctx cancellation.
+func (c *Cache[T]) readFile(ctx context.Context, name string) ([]byte, error) {
+	f, info, err := c.openFile(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return c.readAll(ctx, f, info.Size())
+}
+
+func (c *Cache[T]) readAll(ctx context.Context, f *os.File, size int64) ([]byte, error) {
+	buf := bytes.NewBuffer(make([]byte, 0, size+bytes.MinRead))
+	_, err := buf.ReadFrom(c.newFileReader(ctx, f, size))
+	return buf.Bytes(), err
+}
+
+func (c *Cache[T]) newFileReader(ctx context.Context, f *os.File, size int64) *fileReader {
+	return &fileReader{ctx: ctx, r: f, size: size, progress: c.Progress}
+}
+
+// canStream returns true if cache file f can be decoded by loadStream: the codec is JSON, journal mode is off and
+// there is no journal, and the file is neither encrypted nor has a checksum trailer.
+func (c *Cache[T]) canStream(f *os.File, size int64) bool {
+	if _, ok := c.codec().(jsonCodec); !ok || c.Journal || fsx.FileExists(c.JournalPath()) {
+		return false
+	}
+	head := make([]byte, len(encryptedMagic))
+	if n, _ := f.ReadAt(head, 0); isEncrypted(head[:n]) {
+		return false
+	}
+	if size >= int64(checksumTrailerLen) {
+		tail := make([]byte, len(checksumMagic))
+		if _, err := f.ReadAt(tail, size-int64(checksumTrailerLen)); err != nil || bytes.Equal(tail, checksumMagic) {
+			return false
+		}
+	}
+	return true
+}
+
+// loadStream decodes the cache file, read from fr, directly into the cache data using a json.Decoder so the file
+// contents are never held in memory. errNoStream is returned, and the cache data is not modified, if the cache data
+// has expired or needs migrating. The caller must hold the mutex.
+func (c *Cache[T]) loadStream(fr *fileReader, modTime time.Time) error {
+	fileHash := sha256.New()
+	br := bufio.NewReader(io.TeeReader(fr, fileHash))
+	var src io.Reader = br
+	if head, _ := br.Peek(len(gzipMagic)); isCompressed(head) {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return streamError(fr, nil, err)
+		}
+		defer zr.Close()
+		src = zr
+	}
+	lr := &limitReader{r: src, max: c.MaxSize}
+	dr := bufio.NewReader(lr)
+	env, err := readEnvelope(dr)
+	if err != nil {
+		return streamError(fr, lr, err)
+	}
+	if env.Version != c.Version || env.expired() {
+		return errNoStream
+	}
+	dataHash := sha256.New()
+	tr := io.TeeReader(dr, dataHash)
+	dec := json.NewDecoder(tr)
+	v := new(T)
+	err = dec.Decode(v)
+	if err == nil {
+		var rest []byte
+		rest, err = io.ReadAll(io.MultiReader(dec.Buffered(), tr))
+		if err == nil && len(bytes.TrimSpace(rest)) > 0 {
+			err = errors.New("cache: invalid data after cache data")
+		}
+	}
+	if err == nil {
+		_, err = io.Copy(io.Discard, br)
+	}
+	if err != nil {
+		return streamError(fr, lr, err)
+	}
+	*c.CacheData = *v
+	c.dirty = false
+	c.journalBase = nil
+	c.journalSize = 0
+	c.sha256 = [32]byte{}
+	if len(c.Key) == 0 {
+		c.sha256 = [32]byte(dataHash.Sum(nil))
+	}
+	c.fileSHA256 = [32]byte(fileHash.Sum(nil))
+	c.setLoaded(env, modTime)
+	return nil
+}
+
+// streamError returns the read or size limit error that caused err, otherwise err is a decoding error and is returned
+// as a *CorruptError.
+func streamError(fr *fileReader, lr *limitReader, err error) error {
+	if fr.err != nil {
+		return fr.err
+	}
+	if lr != nil && lr.err != nil {
+		return lr.err
+	}
+	return &CorruptError{Err: err}
+}
@@ -0,0 +1,136 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/srackham/go-utils/assert"
+	"github.com/srackham/go-utils/fsx"
+)
+
+func TestLoadContext(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "valuations.json")
+	data := RatesCache{"2022-06-01": Rates{"USD": 1.00}}
+	c := New(&data)
+	c.CacheFile = file
+	err := c.Save()
+	assert.PassIf(t, err == nil, "%v", err)
+
+	for _, compress := range []bool{false, true} {
+		for _, checksum := range []bool{false, true} {
+			c.Compress = compress
+			c.Checksum = checksum
+			c.TTL = time.Hour
+			data["2022-06-02"] = Rates{"USD": float64(len(data))}
+			err = c.Save()
+			assert.PassIf(t, err == nil, "%v", err)
+
+			loaded := make(RatesCache)
+			c2 := New(&loaded)
+			c2.CacheFile = file
+			c2.TTL = time.Hour
+			var read, size int64
+			c2.Progress = func(n, total int64) {
+				read, size = n, total
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			err = c2.LoadContext(ctx)
+			assert.PassIf(t, errors.Is(err, context.Canceled), "expected context.Canceled: %v", err)
+			assert.Equal(t, 0, len(loaded))
+			assert.PassIf(t, fsx.FileExists(file), "cache file quarantined")
+
+			err = c2.LoadContext(context.Background())
+			assert.PassIf(t, err == nil, "%v", err)
+			assert.PassIf(t, reflect.DeepEqual(data, loaded), "expected:\n%v\n\ngot:\n%v", data, loaded)
+			info, _ := os.Stat(file)
+			assert.Equal(t, info.Size(), size)
+			assert.Equal(t, size, read)
+			// The loaded checksums match so an unchanged cache is not rewritten.
+			assert.Equal(t, c.sha256, c2.sha256)
+			assert.Equal(t, c.fileSHA256, c2.fileSHA256)
+		}
+	}
+}
+
+func TestSaveContext(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "valuations.json")
+	data := RatesCache{"2022-06-01": Rates{"USD": 1.00}}
+	c := New(&data)
+	c.CacheFile = file
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := c.SaveContext(ctx)
+	assert.PassIf(t, errors.Is(err, context.Canceled), "expected context.Canceled: %v", err)
+	assert.False(t, fsx.FileExists(file))
+
+	// Cancellation stops waiting for the cache file lock.
+	c2 := New(&data)
+	c2.CacheFile = file
+	err = c2.LoadLocked()
+	assert.PassIf(t, err == nil, "%v", err)
+	defer c2.Unlock()
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = c.SaveContext(ctx)
+	var lockErr *LockError
+	assert.PassIf(t, errors.As(err, &lockErr), "expected *LockError: %v", err)
+	assert.PassIf(t, errors.Is(err, context.DeadlineExceeded), "expected context.DeadlineExceeded: %v", err)
+	assert.False(t, fsx.FileExists(file))
+}
+
+func TestMaxSize(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "valuations.json")
+	data := RatesCache{"2022-06-01": Rates{"USD": 1.00, "EUR": 1.07, "GBP": 1.25}}
+	c := New(&data)
+	c.CacheFile = file
+	err := c.Save()
+	assert.PassIf(t, err == nil, "%v", err)
+	info, _ := os.Stat(file)
+
+	loaded := make(RatesCache)
+	c2 := New(&loaded)
+	c2.CacheFile = file
+	c2.MaxSize = info.Size() - 1
+	err = c2.Load()
+	assert.PassIf(t, errors.Is(err, ErrTooLarge), "expected ErrTooLarge: %v", err)
+	assert.Equal(t, 0, len(loaded))
+	c2.MaxSize = info.Size()
+	err = c2.Load()
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.Equal(t, 1, len(loaded))
+
+	// The decompressed size is also limited.
+	for _, checksum := range []bool{false, true} {
+		data["2022-06-02"] = Rates{strings.Repeat("X", 1000): float64(len(data))}
+		c.Compress = true
+		c.Checksum = checksum
+		err = c.Save()
+		assert.PassIf(t, err == nil, "%v", err)
+		info, _ = os.Stat(file)
+		c2.MaxSize = info.Size()
+		err = c2.Load()
+		assert.PassIf(t, errors.Is(err, ErrTooLarge), "expected ErrTooLarge: %v", err)
+		assert.PassIf(t, fsx.FileExists(file), "cache file quarantined")
+	}
+}
+
+func TestLoadStreamCorrupt(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "valuations.json")
+	err := fsx.WriteFile(file, `{"2022-06-01": {"USD": 1}} {}`)
+	assert.PassIf(t, err == nil, "%v", err)
+	data := make(RatesCache)
+	c := New(&data)
+	c.CacheFile = file
+	err = c.Load()
+	var corruptErr *CorruptError
+	assert.PassIf(t, errors.As(err, &corruptErr), "expected *CorruptError: %v", err)
+	assert.PassIf(t, corruptErr.MovedTo != "", "corrupt cache file not moved")
+	assert.Equal(t, 0, len(data))
+}
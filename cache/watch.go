@@ -0,0 +1,93 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"os"
+	"time"
+)
+
+// DefaultWatchInterval is the Watch polling interval when Cache.WatchInterval is zero.
+const DefaultWatchInterval = time.Second
+
+// Watch polls the modification times and sizes of the cache file and its journal (see Cache.Journal) and reloads the
+// cache data when the file is changed by another process, changes made by this Cache's Save are ignored. Unsaved
+// changes are not discarded, they are merged with the changed file using Merge or, if Merge is not set, the reload
+// fails with ErrConflict and the cache data is left unchanged. onReload, if not nil, is called after each reload with
+// the Load, Merge or ErrConflict error. Reloads are synchronized with Read, Update, Load and Save. Watch returns when
+// ctx is cancelled.
+func (c *Cache[T]) Watch(ctx context.Context, onReload func(error)) {
+	interval := c.WatchInterval
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var last [2]fileState // Zero so the first poll checks for changes made since the cache was last loaded or saved.
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		current := [2]fileState{statFile(c.CacheFile), statFile(c.JournalPath())}
+		if current == last {
+			continue
+		}
+		last = current
+		if reloaded, err := c.reload(ctx); (reloaded || err != nil) && onReload != nil {
+			onReload(err)
+		}
+	}
+}
+
+// fileState records the file attributes polled by Watch.
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// statFile returns the state of file name, the zero state if the file does not exist.
+func statFile(name string) fileState {
+	info, err := os.Stat(name)
+	if err != nil {
+		return fileState{}
+	}
+	return fileState{modTime: info.ModTime(), size: info.Size()}
+}
+
+// reload loads the cache file if its contents, or its journal, differ from those last loaded or saved. If the cache
+// data has unsaved changes (see IsDirty) they are kept and the cache file is merged into them with Merge, if Merge is
+// not set the cache data is left unchanged and ErrConflict is returned.
+func (c *Cache[T]) reload(ctx context.Context) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	file, err := os.ReadFile(c.CacheFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	if fileSHA := sha256.Sum256(file); fileSHA == c.fileSHA256 {
+		j, err := readJournal(c.JournalPath(), fileSHA)
+		if err != nil {
+			return false, err
+		}
+		if j.size == c.journalSize {
+			return false, nil
+		}
+	}
+	if !c.isDirty() {
+		return true, c.loadFile(ctx, false)
+	}
+	data, err := c.marshal()
+	if err != nil {
+		return true, err
+	}
+	if _, err := c.checkConflict(ctx, data); err != nil {
+		return true, err
+	}
+	c.dirty = true // The merged cache data has not been saved.
+	return true, nil
+}
@@ -0,0 +1,189 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/srackham/go-utils/assert"
+	"github.com/srackham/go-utils/fsx"
+)
+
+func TestWatch(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "counter.json")
+	var data1, data2 Counter
+	c1 := New(&data1)
+	c1.CacheFile = file
+	c1.WatchInterval = 5 * time.Millisecond
+	c2 := New(&data2)
+	c2.CacheFile = file
+	data1.Count = 1
+	err := c1.Save()
+	assert.PassIf(t, err == nil, "%v", err)
+
+	reloads := make(chan error, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c1.Watch(ctx, func(err error) { reloads <- err })
+		close(done)
+	}()
+
+	// Changes made by another cache are reloaded.
+	err = c2.Load()
+	assert.PassIf(t, err == nil, "%v", err)
+	data2.Count = 2
+	err = c2.Save()
+	assert.PassIf(t, err == nil, "%v", err)
+	select {
+	case err := <-reloads:
+		assert.PassIf(t, err == nil, "%v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("cache was not reloaded")
+	}
+	c1.Read(func(data *Counter) {
+		assert.Equal(t, 2, data.Count)
+	})
+
+	// Changes made by the watching cache are ignored.
+	c1.Update(func(data *Counter) error {
+		data.Count = 3
+		return nil
+	})
+	err = c1.Save()
+	assert.PassIf(t, err == nil, "%v", err)
+	select {
+	case err := <-reloads:
+		t.Fatalf("unexpected reload: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Reload errors are reported.
+	err = os.WriteFile(file, []byte(`{"Count": `), 0644)
+	assert.PassIf(t, err == nil, "%v", err)
+	select {
+	case err := <-reloads:
+		assert.PassIf(t, err != nil, "expected reload error")
+	case <-time.After(5 * time.Second):
+		t.Fatal("cache was not reloaded")
+	}
+
+	cancel()
+	<-done
+}
+
+func TestWatchJournal(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "counter.json")
+	var data1, data2 Counter
+	c1 := New(&data1)
+	c1.CacheFile = file
+	c1.Journal = true
+	c1.WatchInterval = 5 * time.Millisecond
+	c2 := New(&data2)
+	c2.CacheFile = file
+	c2.Journal = true
+	err := c1.Save()
+	assert.PassIf(t, err == nil, "%v", err)
+	err = c2.Load()
+	assert.PassIf(t, err == nil, "%v", err)
+
+	reloads := make(chan error, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c1.Watch(ctx, func(err error) { reloads <- err })
+
+	// Changes journaled by another cache are reloaded.
+	data2.Count = 7
+	err = c2.Save()
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.PassIf(t, fsx.FileExists(c2.JournalPath()), "expected journal file")
+	select {
+	case err := <-reloads:
+		assert.PassIf(t, err == nil, "%v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("cache was not reloaded")
+	}
+	c1.Read(func(data *Counter) {
+		assert.Equal(t, 7, data.Count)
+	})
+}
+
+func TestWatchUnsavedChanges(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "rates.json")
+	data1 := RatesCache{"a": Rates{"USD": 1.00}}
+	var data2 RatesCache
+	c1 := New(&data1)
+	c1.CacheFile = file
+	c1.WatchInterval = 5 * time.Millisecond
+	c2 := New(&data2)
+	c2.CacheFile = file
+	err := c1.Save()
+	assert.PassIf(t, err == nil, "%v", err)
+	err = c2.Load()
+	assert.PassIf(t, err == nil, "%v", err)
+
+	// watch calls save and then watches c1 until the saved file has been reloaded and returns the reload error.
+	watch := func(save func()) error {
+		t.Helper()
+		save()
+		reloads := make(chan error, 10)
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			c1.Watch(ctx, func(err error) { reloads <- err })
+			close(done)
+		}()
+		defer func() {
+			cancel()
+			<-done
+		}()
+		select {
+		case err := <-reloads:
+			return err
+		case <-time.After(5 * time.Second):
+			t.Fatal("cache was not reloaded")
+		}
+		return nil
+	}
+
+	// Without Merge unsaved changes are kept and the reload fails.
+	c1.Update(func(data *RatesCache) error {
+		(*data)["local"] = Rates{"USD": 2.00}
+		return nil
+	})
+	err = watch(func() {
+		data2["b"] = Rates{"USD": 3.00}
+		err := c2.Save()
+		assert.PassIf(t, err == nil, "%v", err)
+	})
+	assert.PassIf(t, errors.Is(err, ErrConflict), "expected ErrConflict: %v", err)
+	assert.Equal(t, 2, len(data1))
+	assert.Equal(t, 2.00, data1["local"]["USD"])
+	assert.True(t, c1.IsDirty())
+
+	// With Merge the changed file is merged into the unsaved changes.
+	c1.Merge = func(onDisk, inMemory *RatesCache) error {
+		for k, v := range *onDisk {
+			if _, ok := (*inMemory)[k]; !ok {
+				(*inMemory)[k] = v
+			}
+		}
+		return nil
+	}
+	err = watch(func() {
+		data2["c"] = Rates{"USD": 4.00}
+		err := c2.Save()
+		assert.PassIf(t, err == nil, "%v", err)
+	})
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.Equal(t, 4, len(data1))
+	assert.True(t, c1.IsDirty())
+	err = c1.Save()
+	assert.PassIf(t, err == nil, "%v", err)
+	err = c2.Load()
+	assert.PassIf(t, err == nil, "%v", err)
+	assert.Equal(t, 4, len(data2))
+}
@@ -0,0 +1,281 @@
+package fsx
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrExists is returned when copying would replace an existing file and CopyOptions.Overwrite is OverwriteNever.
+var ErrExists = errors.New("fsx: destination file exists")
+
+// Overwrite determines how copying treats existing destination files.
+type Overwrite int
+
+const (
+	OverwriteAlways  Overwrite = iota // Replace existing files (the default).
+	OverwriteNever                    // Return ErrExists.
+	OverwriteSkip                     // Leave existing files unchanged.
+	OverwriteIfNewer                  // Replace existing files that are older than the source file.
+)
+
+// CopyOptions configures CopyFileOptions and CopyDir.
+//
+// The destination file is given the source file's mode unless WriteOptions.Mode is set, if WriteOptions.PreserveMode
+// is set an existing destination file keeps its mode. Existing destination files are always replaced atomically (see
+// WriteOptions.Atomic), not truncated and rewritten, so read-only files can be copied over.
+type CopyOptions struct {
+	WriteOptions
+	PreserveTimes bool      // Set the destination file modification time to the source file's.
+	Overwrite     Overwrite // Existing destination file policy.
+	CopySymlinks  bool      // Copy symbolic links as links instead of copying the files they refer to.
+	Include       []string  // CopyDir copies only files matching one of these patterns (default all files).
+	Exclude       []string  // CopyDir skips files and directories matching any of these patterns.
+}
+
+// CopyFileOptions copies file from to file to using options opts. The file contents are streamed and, where the
+// platform supports it, copied by the kernel (e.g. copy_file_range on Linux).
+func CopyFileOptions(from, to string, opts CopyOptions) error {
+	lstat, err := os.Lstat(from)
+	if err != nil {
+		return err
+	}
+	if opts.CopySymlinks && lstat.Mode()&os.ModeSymlink != 0 {
+		return copySymlink(from, to, opts)
+	}
+	info, err := os.Stat(from)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return &os.PathError{Op: "copy", Path: from, Err: errors.New("not a regular file")}
+	}
+	wopts := opts.WriteOptions
+	if dst, err := os.Stat(to); err == nil {
+		if os.SameFile(info, dst) {
+			return &os.PathError{Op: "copy", Path: to, Err: errors.New("source and destination are the same file")}
+		}
+		if ok, err := overwrite(to, info, dst, opts.Overwrite); !ok {
+			return err
+		}
+		wopts.Atomic = true
+	}
+	f, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if wopts.Mode == 0 {
+		wopts.Mode = info.Mode().Perm()
+	}
+	err = WriteFileFunc(to, wopts, func(w *os.File) error {
+		_, err := io.Copy(w, f) // *os.File.ReadFrom uses copy_file_range or sendfile when available.
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if opts.PreserveTimes {
+		return os.Chtimes(to, time.Time{}, info.ModTime())
+	}
+	return nil
+}
+
+// overwrite returns true if the existing destination file to, described by dst, should be replaced by the source
+// file described by src.
+func overwrite(to string, src, dst os.FileInfo, policy Overwrite) (bool, error) {
+	switch policy {
+	case OverwriteNever:
+		return false, &os.PathError{Op: "copy", Path: to, Err: ErrExists}
+	case OverwriteSkip:
+		return false, nil
+	case OverwriteIfNewer:
+		return src.ModTime().After(dst.ModTime()), nil
+	default:
+		return true, nil
+	}
+}
+
+// copySymlink creates symbolic link to with the same target as symbolic link from.
+func copySymlink(from, to string, opts CopyOptions) error {
+	target, err := os.Readlink(from)
+	if err != nil {
+		return err
+	}
+	if dst, err := os.Lstat(to); err == nil {
+		if dst.IsDir() {
+			return &os.PathError{Op: "copy", Path: to, Err: errors.New("destination is a directory")}
+		}
+		src, err := os.Lstat(from)
+		if err != nil {
+			return err
+		}
+		if ok, err := overwrite(to, src, dst, opts.Overwrite); !ok {
+			return err
+		}
+	}
+	// Create the link alongside the destination and rename it so an existing destination is replaced atomically.
+	tmp := fmt.Sprintf("%s.tmp-%d", to, time.Now().UnixNano())
+	if err := os.Symlink(target, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, to); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// CopyDir copies the files in directory tree src to directory dst using options opts, destination paths are
+// translated from source paths by PathTranslate. Missing destination directories are created with the source
+// directory's mode, empty source directories are only created when there are no Include patterns.
+//
+// Include and Exclude patterns use Match syntax and are matched against slash separated paths relative to src,
+// patterns that do not contain a slash are matched against the file or directory name. Symbolic links to
+// directories, and dangling symbolic links, are copied as links. Files that are neither regular files nor symbolic
+// links are skipped.
+func CopyDir(src, dst string, opts CopyOptions) error {
+	entries, err := copyEntries(src, dst, opts)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		from := filepath.Join(src, filepath.FromSlash(e.rel))
+		target := PathTranslate(from, src, dst)
+		if e.dir {
+			if e.rel == "." || len(opts.Include) == 0 {
+				if err := mkdirLike(target, from); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if err := mkdirLike(filepath.Dir(target), filepath.Dir(from)); err != nil {
+			return err
+		}
+		fileOpts := opts
+		fileOpts.CopySymlinks = e.link
+		if err := CopyFileOptions(from, target, fileOpts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// treeEntry is a file or directory in a directory tree.
+type treeEntry struct {
+	rel  string // Slash separated path relative to the tree root, the root is ".".
+	dir  bool
+	link bool // A symbolic link that is copied as a link.
+}
+
+// copyEntries returns the directories, and the files selected by the Include and Exclude patterns, that CopyDir
+// copies from src to dst in lexical order. An error is returned if dst is inside src.
+func copyEntries(src, dst string, opts CopyOptions) ([]treeEntry, error) {
+	info, err := os.Stat(src)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, &os.PathError{Op: "copy", Path: src, Err: errors.New("not a directory")}
+	}
+	if err := checkPatterns(opts.Include); err != nil {
+		return nil, err
+	}
+	if err := checkPatterns(opts.Exclude); err != nil {
+		return nil, err
+	}
+	absSrc, err := filepath.Abs(src)
+	if err != nil {
+		return nil, err
+	}
+	absDst, err := filepath.Abs(dst)
+	if err != nil {
+		return nil, err
+	}
+	if PathIsInDir(absDst, absSrc) {
+		return nil, fmt.Errorf("fsx: destination %s is inside source directory %s", dst, src)
+	}
+	var entries []treeEntry
+	err = filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			if rel != "." && matchAny(opts.Exclude, rel) {
+				return filepath.SkipDir
+			}
+			entries = append(entries, treeEntry{rel: rel, dir: true})
+			return nil
+		}
+		if !opts.selected(rel) {
+			return nil
+		}
+		e := treeEntry{rel: rel}
+		switch {
+		case d.Type()&os.ModeSymlink != 0:
+			info, err := os.Stat(p)
+			// Dangling links and links to directories are always copied as links.
+			e.link = opts.CopySymlinks || err != nil || info.IsDir()
+		case !d.Type().IsRegular():
+			return nil
+		}
+		entries = append(entries, e)
+		return nil
+	})
+	return entries, err
+}
+
+// selected returns true if the file at slash separated relative path rel is selected by the Include and Exclude
+// patterns.
+func (opts CopyOptions) selected(rel string) bool {
+	return !matchAny(opts.Exclude, rel) && (len(opts.Include) == 0 || matchAny(opts.Include, rel))
+}
+
+// mkdirLike creates directory dir, and any missing parents, with the mode of directory like.
+func mkdirLike(dir, like string) error {
+	if DirExists(dir) {
+		return nil
+	}
+	info, err := os.Stat(like)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(dir, info.Mode().Perm())
+}
+
+// checkPatterns returns path.ErrBadPattern if any of the patterns are malformed.
+func checkPatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := compileGlob(pattern); err != nil {
+			return fmt.Errorf("%w: %q", err, pattern)
+		}
+	}
+	return nil
+}
+
+// matchAny returns true if slash separated relative path rel matches any of the patterns, patterns that do not
+// contain a slash are matched against the last element of rel.
+func matchAny(patterns []string, rel string) bool {
+	for _, pattern := range patterns {
+		name := rel
+		if !strings.Contains(pattern, "/") {
+			name = path.Base(rel)
+		}
+		if ok, _ := Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
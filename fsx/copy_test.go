@@ -0,0 +1,230 @@
+package fsx
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCopyFileOptions(t *testing.T) {
+	tempDir := t.TempDir()
+	fromName := filepath.Join(tempDir, "test_copy_file_from")
+	toName := filepath.Join(tempDir, "test_copy_file_to")
+	text := strings.Repeat("Test\n", 100000)
+	if err := WriteFileOptions(fromName, text, WriteOptions{Mode: 0600}); err != nil {
+		t.Errorf("WriteFileOptions failed with error: %v", err)
+	}
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := os.Chtimes(fromName, modTime, modTime); err != nil {
+		t.Errorf("Chtimes failed with error: %v", err)
+	}
+
+	err := CopyFileOptions(fromName, toName, CopyOptions{WriteOptions: WriteOptions{Atomic: true}, PreserveTimes: true})
+	if err != nil {
+		t.Errorf("CopyFileOptions failed with error: %v", err)
+	}
+	if readText, _ := ReadFile(toName); readText != text {
+		t.Errorf("CopyFileOptions did not copy the same text as written")
+	}
+	if mode := fileMode(t, toName); mode != 0600 {
+		t.Errorf("CopyFileOptions did not copy mode, got: %v, want: %v", mode, os.FileMode(0600))
+	}
+	if got := FileModTime(toName); !got.Equal(modTime) {
+		t.Errorf("CopyFileOptions did not copy modification time, got: %v, want: %v", got, modTime)
+	}
+
+	// PreserveMode keeps the destination file's mode.
+	if err := os.Chmod(toName, 0640); err != nil {
+		t.Errorf("Chmod failed with error: %v", err)
+	}
+	err = CopyFileOptions(fromName, toName, CopyOptions{WriteOptions: WriteOptions{PreserveMode: true}})
+	if err != nil {
+		t.Errorf("CopyFileOptions failed with error: %v", err)
+	}
+	if mode := fileMode(t, toName); mode != 0640 {
+		t.Errorf("CopyFileOptions did not preserve mode, got: %v, want: %v", mode, os.FileMode(0640))
+	}
+
+	err = CopyFileOptions(fromName, fromName, CopyOptions{})
+	if err == nil {
+		t.Errorf("CopyFileOptions copied a file to itself")
+	}
+	err = CopyFileOptions(tempDir, toName, CopyOptions{})
+	if err == nil {
+		t.Errorf("CopyFileOptions copied a directory")
+	}
+}
+
+func TestCopyFileOverwrite(t *testing.T) {
+	tempDir := t.TempDir()
+	fromName := filepath.Join(tempDir, "from")
+	toName := filepath.Join(tempDir, "to")
+	if err := WriteFile(fromName, "new"); err != nil {
+		t.Errorf("WriteFile failed with error: %v", err)
+	}
+	if err := WriteFile(toName, "old"); err != nil {
+		t.Errorf("WriteFile failed with error: %v", err)
+	}
+	older := time.Now().Add(-time.Hour)
+	newer := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		policy  Overwrite
+		modTime time.Time // Destination file modification time.
+		want    string
+		err     error
+	}{
+		{OverwriteNever, older, "old", ErrExists},
+		{OverwriteSkip, older, "old", nil},
+		{OverwriteIfNewer, newer, "old", nil},
+		{OverwriteIfNewer, older, "new", nil},
+		{OverwriteAlways, newer, "new", nil},
+	}
+	for _, tt := range tests {
+		if err := WriteFile(toName, "old"); err != nil {
+			t.Errorf("WriteFile failed with error: %v", err)
+		}
+		if err := os.Chtimes(toName, tt.modTime, tt.modTime); err != nil {
+			t.Errorf("Chtimes failed with error: %v", err)
+		}
+		err := CopyFileOptions(fromName, toName, CopyOptions{Overwrite: tt.policy})
+		if !errors.Is(err, tt.err) {
+			t.Errorf("CopyFileOptions with policy %d returned error: %v, want: %v", tt.policy, err, tt.err)
+		}
+		if got, _ := ReadFile(toName); got != tt.want {
+			t.Errorf("CopyFileOptions with policy %d, got: %s, want: %s", tt.policy, got, tt.want)
+		}
+	}
+}
+
+func TestCopyFileReadOnly(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("read-only files cannot be replaced on Windows")
+	}
+	if os.Geteuid() == 0 {
+		t.Skip("file permissions are not enforced for root")
+	}
+	tempDir := t.TempDir()
+	fromName := filepath.Join(tempDir, "from")
+	toName := filepath.Join(tempDir, "to")
+	if err := WriteFileOptions(fromName, "Test", WriteOptions{Mode: 0444}); err != nil {
+		t.Errorf("WriteFileOptions failed with error: %v", err)
+	}
+	for range 2 {
+		if err := CopyFile(fromName, toName); err != nil {
+			t.Fatalf("CopyFile failed with error: %v", err)
+		}
+	}
+	if readText, _ := ReadFile(toName); readText != "Test" {
+		t.Errorf("CopyFile did not copy the same text as written")
+	}
+	if mode := fileMode(t, toName); mode != 0444 {
+		t.Errorf("CopyFile did not copy mode, got: %v, want: %v", mode, os.FileMode(0444))
+	}
+}
+
+func TestCopyFileSymlink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symbolic links require privileges on Windows")
+	}
+	tempDir := t.TempDir()
+	target := filepath.Join(tempDir, "target")
+	link := filepath.Join(tempDir, "link")
+	toName := filepath.Join(tempDir, "to")
+	if err := WriteFile(target, "Test"); err != nil {
+		t.Errorf("WriteFile failed with error: %v", err)
+	}
+	if err := os.Symlink("target", link); err != nil {
+		t.Errorf("Symlink failed with error: %v", err)
+	}
+
+	// Symbolic links are followed by default.
+	if err := CopyFileOptions(link, toName, CopyOptions{}); err != nil {
+		t.Errorf("CopyFileOptions failed with error: %v", err)
+	}
+	if info, err := os.Lstat(toName); err != nil || !info.Mode().IsRegular() {
+		t.Errorf("CopyFileOptions did not copy the link target")
+	}
+
+	if err := CopyFileOptions(link, toName, CopyOptions{CopySymlinks: true}); err != nil {
+		t.Errorf("CopyFileOptions failed with error: %v", err)
+	}
+	if got, err := os.Readlink(toName); err != nil || got != "target" {
+		t.Errorf("CopyFileOptions did not copy the link, got: %q, %v", got, err)
+	}
+}
+
+// treeFiles returns the slash separated relative paths of the files and directories in dir.
+func treeFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	var result []string
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || p == dir {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, p)
+		if info.IsDir() {
+			rel += "/"
+		}
+		result = append(result, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Walk failed with error: %v", err)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func TestCopyDir(t *testing.T) {
+	tempDir := t.TempDir()
+	src := filepath.Join(tempDir, "src")
+	for _, name := range []string{"a.txt", "b.go", "sub/c.txt", "sub/d.go", ".git/config", "empty/"} {
+		p := filepath.Join(src, name)
+		if strings.HasSuffix(name, "/") {
+			if err := os.MkdirAll(p, 0775); err != nil {
+				t.Errorf("MkdirAll failed with error: %v", err)
+			}
+			continue
+		}
+		if err := WritePath(p, name); err != nil {
+			t.Errorf("WritePath failed with error: %v", err)
+		}
+	}
+
+	dst := filepath.Join(tempDir, "dst")
+	err := CopyDir(src, dst, CopyOptions{Exclude: []string{".git"}})
+	if err != nil {
+		t.Errorf("CopyDir failed with error: %v", err)
+	}
+	want := []string{"a.txt", "b.go", "empty/", "sub/", "sub/c.txt", "sub/d.go"}
+	if got := treeFiles(t, dst); !reflect.DeepEqual(got, want) {
+		t.Errorf("CopyDir copied: %v, want: %v", got, want)
+	}
+	if text, _ := ReadFile(filepath.Join(dst, "sub", "c.txt")); text != "sub/c.txt" {
+		t.Errorf("CopyDir did not copy file contents, got: %s", text)
+	}
+
+	dst = filepath.Join(tempDir, "dst2")
+	err = CopyDir(src, dst, CopyOptions{Include: []string{"*.go"}, Exclude: []string{"sub/d.go"}})
+	if err != nil {
+		t.Errorf("CopyDir failed with error: %v", err)
+	}
+	want = []string{"b.go"}
+	if got := treeFiles(t, dst); !reflect.DeepEqual(got, want) {
+		t.Errorf("CopyDir copied: %v, want: %v", got, want)
+	}
+
+	if err := CopyDir(src, filepath.Join(src, "sub", "dst"), CopyOptions{}); err == nil {
+		t.Errorf("CopyDir copied a directory into itself")
+	}
+	if err := CopyDir(src, dst, CopyOptions{Include: []string{"[a"}}); err == nil {
+		t.Errorf("CopyDir accepted a malformed pattern")
+	}
+}
@@ -61,13 +61,9 @@ func ReplaceExt(name, ext string) string {
 	return name[0:len(name)-len(filepath.Ext(name))] + ext
 }
 
+// CopyFile copies file from to file to, the destination is given the source file's mode (see CopyFileOptions).
 func CopyFile(from, to string) error {
-	contents, err := ReadFile(from)
-	if err != nil {
-		return err
-	}
-	err = WriteFile(to, contents)
-	return err
+	return CopyFileOptions(from, to, CopyOptions{})
 }
 
 func MkMissingDir(dir string) error {
@@ -0,0 +1,185 @@
+package fsx
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// globPattern is a compiled Match pattern.
+type globPattern struct {
+	alts [][]string // The brace expanded alternatives split into path elements.
+}
+
+// compileGlob validates and compiles a Match pattern.
+func compileGlob(pattern string) (globPattern, error) {
+	var g globPattern
+	alts, err := expandBraces(pattern)
+	if err != nil {
+		return g, err
+	}
+	for _, alt := range alts {
+		elems := strings.Split(alt, "/")
+		for _, elem := range elems {
+			if _, err := path.Match(elem, ""); err != nil {
+				return g, err
+			}
+		}
+		g.alts = append(g.alts, elems)
+	}
+	return g, nil
+}
+
+// match returns true if slash separated path name matches the pattern.
+func (g globPattern) match(name string) bool {
+	names := strings.Split(name, "/")
+	for _, elems := range g.alts {
+		if matchElems(elems, names) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchElems matches path elements against pattern elements, a "**" pattern element matches zero or more path
+// elements.
+func matchElems(pattern, names []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for len(pattern) > 1 && pattern[1] == "**" {
+				pattern = pattern[1:]
+			}
+			for i := 0; i <= len(names); i++ {
+				if matchElems(pattern[1:], names[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(names) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], names[0]); !ok {
+			return false
+		}
+		pattern, names = pattern[1:], names[1:]
+	}
+	return len(names) == 0
+}
+
+// expandBraces returns the alternatives described by the brace expressions in pattern e.g. "a{b,c{d,e}}" expands to
+// "ab", "acd" and "ace". Braces inside character classes and escaped braces are not expanded.
+func expandBraces(pattern string) ([]string, error) {
+	start, end := -1, -1
+	var commas []int
+	depth := 0
+	inClass := false
+scan:
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case c == '\\':
+			i++
+		case inClass:
+			inClass = c != ']'
+		case c == '[':
+			inClass = true
+		case c == '{':
+			if depth == 0 {
+				start = i
+			}
+			depth++
+		case c == ',' && depth == 1:
+			commas = append(commas, i)
+		case c == '}' && depth > 0:
+			depth--
+			if depth == 0 {
+				end = i
+				break scan
+			}
+		}
+	}
+	if depth > 0 {
+		return nil, fmt.Errorf("%w: unmatched brace", path.ErrBadPattern)
+	}
+	if start < 0 {
+		return []string{pattern}, nil
+	}
+	prefix, suffix := pattern[:start], pattern[end+1:]
+	var result []string
+	from := start + 1
+	for _, to := range append(commas, end) {
+		alts, err := expandBraces(prefix + pattern[from:to] + suffix)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, alts...)
+		from = to + 1
+	}
+	return result, nil
+}
+
+// Match reports whether slash separated path name matches pattern. The pattern syntax is that of path.Match with
+// two extensions: a "**" path element matches zero or more path elements, and "{a,b,...}" matches any one of the
+// comma separated alternatives, which can contain patterns and nested braces. The only possible returned error is
+// path.ErrBadPattern.
+func Match(pattern, name string) (bool, error) {
+	g, err := compileGlob(pattern)
+	if err != nil {
+		return false, err
+	}
+	return g.match(name), nil
+}
+
+// Glob returns the files and directories in directory tree root whose slash separated paths, relative to root, match
+// the patterns (see Match). Patterns prefixed with "!" are negated: a path is selected if the last pattern it matches
+// is not negated, so later patterns override earlier ones e.g. "**/*.go", "!**/*_test.go". The returned paths are
+// joined to root and sorted.
+func Glob(root string, patterns ...string) ([]string, error) {
+	return GlobOptions(root, WalkOptions{}, patterns...)
+}
+
+// GlobOptions is like Glob but walks the directory tree with options opts (see Walk).
+func GlobOptions(root string, opts WalkOptions, patterns ...string) ([]string, error) {
+	type rule struct {
+		glob   globPattern
+		negate bool
+	}
+	var rules []rule
+	for _, pattern := range patterns {
+		negate := strings.HasPrefix(pattern, "!")
+		g, err := compileGlob(strings.TrimPrefix(pattern, "!"))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", err, pattern)
+		}
+		rules = append(rules, rule{g, negate})
+	}
+	var result []string
+	err := Walk(root, opts, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		selected := false
+		for _, r := range rules {
+			if r.glob.match(rel) {
+				selected = !r.negate
+			}
+		}
+		if selected {
+			result = append(result, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(result)
+	return result, nil
+}
@@ -0,0 +1,83 @@
+package fsx
+
+import (
+	"errors"
+	"path"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"*.go", "main.go", true},
+		{"*.go", "cmd/main.go", false},
+		{"**/*.go", "main.go", true},
+		{"**/*.go", "cmd/app/main.go", true},
+		{"cmd/**", "cmd/app/main.go", true},
+		{"cmd/**", "cmd", true},
+		{"cmd/**/main.go", "cmd/main.go", true},
+		{"cmd/**/main.go", "cmd/a/b/main.go", true},
+		{"cmd/**/main.go", "cmd/a/b/main.txt", false},
+		{"**/**/x", "a/x", true},
+		{"*.{go,md}", "README.md", true},
+		{"*.{go,md}", "README.txt", false},
+		{"{cmd,internal/{a,b}}/*.go", "internal/b/x.go", true},
+		{"{cmd,internal/{a,b}}/*.go", "internal/c/x.go", false},
+		{"[{]*", "{x", true},
+		{`\{x\}`, "{x}", true},
+		{"{}x", "x", true},
+	}
+	for _, tt := range tests {
+		got, err := Match(tt.pattern, tt.name)
+		if err != nil {
+			t.Errorf("Match(%q, %q) failed with error: %v", tt.pattern, tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("Match(%q, %q) returned: %v, want: %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+	for _, pattern := range []string{"{a,b", "[a", "a/**/[b"} {
+		if _, err := Match(pattern, "a"); !errors.Is(err, path.ErrBadPattern) {
+			t.Errorf("Match(%q) returned error: %v, want: %v", pattern, err, path.ErrBadPattern)
+		}
+	}
+}
+
+func TestGlob(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, name := range []string{"main.go", "main_test.go", "README.md", "cmd/app/app.go", "cmd/app/app_test.go", "docs/x.txt"} {
+		if err := WritePath(filepath.Join(tempDir, name), name); err != nil {
+			t.Errorf("WritePath failed with error: %v", err)
+		}
+	}
+	tests := []struct {
+		patterns []string
+		want     []string
+	}{
+		{[]string{"*.go"}, []string{"main.go", "main_test.go"}},
+		{[]string{"**/*.go", "!**/*_test.go"}, []string{"cmd/app/app.go", "main.go"}},
+		{[]string{"**/*.{go,md}", "!**/*_test.go", "**/app_test.go"}, []string{"README.md", "cmd/app/app.go", "cmd/app/app_test.go", "main.go"}},
+		{[]string{"cmd/**"}, []string{"cmd", "cmd/app", "cmd/app/app.go", "cmd/app/app_test.go"}},
+		{[]string{"*.txt"}, nil},
+	}
+	for _, tt := range tests {
+		got, err := Glob(tempDir, tt.patterns...)
+		if err != nil {
+			t.Errorf("Glob(%q) failed with error: %v", tt.patterns, err)
+		}
+		var want []string
+		for _, name := range tt.want {
+			want = append(want, filepath.Join(tempDir, filepath.FromSlash(name)))
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Glob(%q) returned: %v, want: %v", tt.patterns, got, want)
+		}
+	}
+	if _, err := Glob(tempDir, "{a"); err == nil {
+		t.Errorf("Glob accepted a malformed pattern")
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package fsx
+
+import "os"
+
+// chownLike is a no-op, file ownership is not preserved on this platform.
+func chownLike(f *os.File, info os.FileInfo) error {
+	return nil
+}
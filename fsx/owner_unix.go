@@ -0,0 +1,17 @@
+//go:build unix
+
+package fsx
+
+import (
+	"os"
+	"syscall"
+)
+
+// chownLike sets the owner and group of file f to those of the file described by info.
+func chownLike(f *os.File, info os.FileInfo) error {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	return f.Chown(int(st.Uid), int(st.Gid))
+}
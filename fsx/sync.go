@@ -0,0 +1,266 @@
+package fsx
+
+import (
+	"crypto/sha256"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// SyncOptions configures SyncDir.
+type SyncOptions struct {
+	CopyOptions      // File copy options and Include/Exclude patterns, Overwrite and PreserveTimes are ignored.
+	Checksum    bool // Compare file contents instead of modification times and sizes.
+	Delete      bool // Delete destination files and directories that are not in the source tree.
+	DryRun      bool // Return the actions that would be taken without changing the destination.
+}
+
+// SyncAction is the action taken by SyncDir.
+type SyncAction int
+
+const (
+	SyncCreate SyncAction = iota + 1 // Copy a new file or create a directory.
+	SyncUpdate                       // Replace a changed file.
+	SyncDelete                       // Delete an extraneous file or directory.
+)
+
+func (a SyncAction) String() string {
+	switch a {
+	case SyncCreate:
+		return "create"
+	case SyncUpdate:
+		return "update"
+	case SyncDelete:
+		return "delete"
+	default:
+		return "unknown"
+	}
+}
+
+// SyncResult records an action taken, or in a dry run planned, by SyncDir.
+type SyncResult struct {
+	Path   string // Slash separated path relative to the source and destination directories.
+	Dir    bool   // Path is a directory.
+	Action SyncAction
+	Err    error // The error if the action failed.
+}
+
+// String returns the result as "<action> <path>", directory paths end with a slash.
+func (r SyncResult) String() string {
+	p := r.Path
+	if r.Dir && !strings.HasSuffix(p, "/") {
+		p += "/"
+	}
+	s := r.Action.String() + " " + p
+	if r.Err != nil {
+		s += ": " + r.Err.Error()
+	}
+	return s
+}
+
+// SyncDir updates directory tree dst so that it mirrors directory tree src, only new and changed files are copied.
+// Files are compared by size and modification time or, if opts.Checksum is set, by size and contents. Copied files
+// keep their source modification times so unchanged files are skipped by subsequent syncs. Files and directories are
+// selected and copied as they are by CopyDir, files are always written atomically (see WriteOptions.Atomic).
+//
+// If opts.Delete is set then destination files and directories that are not in the source tree are deleted first,
+// destination files that are not selected by the Include and Exclude patterns, and the directories containing them,
+// are kept. If opts.DryRun is set the destination is not changed.
+//
+// SyncDir returns the actions, in the order they were taken, unchanged files are not reported. Failed actions do not
+// stop the sync, they are recorded in the results and joined in the returned error.
+func SyncDir(src, dst string, opts SyncOptions) ([]SyncResult, error) {
+	copyOpts := opts.CopyOptions
+	copyOpts.Overwrite = OverwriteAlways
+	copyOpts.PreserveTimes = true
+	copyOpts.Atomic = true // Replace read-only destination files.
+	entries, err := copyEntries(src, dst, copyOpts)
+	if err != nil {
+		return nil, err
+	}
+	var results []SyncResult
+	var errs []error
+	record := func(r SyncResult) {
+		results = append(results, r)
+		if r.Err != nil {
+			errs = append(errs, &os.PathError{Op: "sync " + r.Action.String(), Path: r.Path, Err: r.Err})
+		}
+	}
+	if opts.Delete && DirExists(dst) {
+		deletes, err := syncDeletes(dst, entries, copyOpts)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range deletes {
+			if !opts.DryRun {
+				r.Err = os.Remove(filepath.Join(dst, filepath.FromSlash(r.Path)))
+			}
+			record(r)
+		}
+	}
+	for _, e := range entries {
+		from := filepath.Join(src, filepath.FromSlash(e.rel))
+		target := PathTranslate(from, src, dst)
+		if e.dir {
+			if DirExists(target) || e.rel != "." && len(copyOpts.Include) > 0 {
+				continue
+			}
+			r := SyncResult{Path: e.rel, Dir: true, Action: SyncCreate}
+			if !opts.DryRun {
+				r.Err = mkdirLike(target, from)
+			}
+			record(r)
+			continue
+		}
+		action, err := syncAction(from, target, e.link, opts.Checksum)
+		if action == 0 && err == nil {
+			continue
+		}
+		r := SyncResult{Path: e.rel, Action: action, Err: err}
+		if err == nil && !opts.DryRun {
+			r.Err = syncFile(from, target, e.link, copyOpts)
+		}
+		record(r)
+	}
+	return results, errors.Join(errs...)
+}
+
+// syncDeletes returns the destination files and directories that are not in the source tree entries, children are
+// returned before their parents.
+func syncDeletes(dst string, entries []treeEntry, opts CopyOptions) ([]SyncResult, error) {
+	dirs := make(map[string]bool) // Source entries, the value is true for directories.
+	for _, e := range entries {
+		dirs[e.rel] = e.dir
+	}
+	var extra []treeEntry
+	kept := make(map[string]bool) // Destination directories containing kept files.
+	err := filepath.WalkDir(dst, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dst, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if isDir, ok := dirs[rel]; ok && isDir == d.IsDir() {
+			kept[path.Dir(rel)] = true
+			return nil
+		}
+		if matchAny(opts.Exclude, rel) || !d.IsDir() && !opts.selected(rel) {
+			kept[path.Dir(rel)] = true
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		extra = append(extra, treeEntry{rel: rel, dir: d.IsDir()})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	var results []SyncResult
+	for i := len(extra) - 1; i >= 0; i-- {
+		e := extra[i]
+		if e.dir && kept[e.rel] {
+			kept[path.Dir(e.rel)] = true
+			continue
+		}
+		results = append(results, SyncResult{Path: e.rel, Dir: e.dir, Action: SyncDelete})
+	}
+	return results, nil
+}
+
+// syncAction returns the action required to update destination file to from source file from, zero if to is
+// unchanged.
+func syncAction(from, to string, link, checksum bool) (SyncAction, error) {
+	dst, err := os.Lstat(to)
+	if errors.Is(err, fs.ErrNotExist) {
+		return SyncCreate, nil
+	}
+	if err != nil {
+		return SyncUpdate, err
+	}
+	if link {
+		if dst.Mode()&os.ModeSymlink == 0 {
+			return SyncUpdate, nil
+		}
+		want, err := os.Readlink(from)
+		if err != nil {
+			return SyncUpdate, err
+		}
+		if got, err := os.Readlink(to); err != nil || got != want {
+			return SyncUpdate, err
+		}
+		return 0, nil
+	}
+	if !dst.Mode().IsRegular() {
+		return SyncUpdate, nil
+	}
+	src, err := os.Stat(from)
+	if err != nil {
+		return SyncUpdate, err
+	}
+	if src.Size() != dst.Size() {
+		return SyncUpdate, nil
+	}
+	if !checksum {
+		if src.ModTime().Equal(dst.ModTime()) {
+			return 0, nil
+		}
+		return SyncUpdate, nil
+	}
+	same, err := sameContents(from, to)
+	if err != nil || !same {
+		return SyncUpdate, err
+	}
+	return 0, nil
+}
+
+// syncFile copies file from to file to, a destination that is not the same type of file is removed first.
+func syncFile(from, to string, link bool, opts CopyOptions) error {
+	if dst, err := os.Lstat(to); err == nil {
+		isLink := dst.Mode()&os.ModeSymlink != 0
+		if isLink != link && !dst.IsDir() {
+			if err := os.Remove(to); err != nil {
+				return err
+			}
+		}
+	}
+	if err := mkdirLike(filepath.Dir(to), filepath.Dir(from)); err != nil {
+		return err
+	}
+	opts.CopySymlinks = link
+	return CopyFileOptions(from, to, opts)
+}
+
+// sameContents returns true if files a and b have the same contents.
+func sameContents(a, b string) (bool, error) {
+	sa, err := fileSHA256(a)
+	if err != nil {
+		return false, err
+	}
+	sb, err := fileSHA256(b)
+	if err != nil {
+		return false, err
+	}
+	return sa == sb, nil
+}
+
+func fileSHA256(name string) ([32]byte, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return [32]byte{}, err
+	}
+	return [32]byte(h.Sum(nil)), nil
+}
@@ -0,0 +1,180 @@
+package fsx
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// syncPlan returns the results as strings.
+func syncPlan(results []SyncResult) []string {
+	var plan []string
+	for _, r := range results {
+		plan = append(plan, r.String())
+	}
+	return plan
+}
+
+func TestSyncDir(t *testing.T) {
+	tempDir := t.TempDir()
+	src := filepath.Join(tempDir, "src")
+	dst := filepath.Join(tempDir, "dst")
+	for _, name := range []string{"a.txt", "sub/b.txt", "sub/c.tmp"} {
+		if err := WritePath(filepath.Join(src, name), name); err != nil {
+			t.Errorf("WritePath failed with error: %v", err)
+		}
+	}
+	opts := SyncOptions{CopyOptions: CopyOptions{Exclude: []string{"*.tmp"}}, Delete: true}
+
+	// A dry run does not change the destination.
+	opts.DryRun = true
+	results, err := SyncDir(src, dst, opts)
+	if err != nil {
+		t.Errorf("SyncDir failed with error: %v", err)
+	}
+	want := []string{"create ./", "create a.txt", "create sub/", "create sub/b.txt"}
+	if got := syncPlan(results); !reflect.DeepEqual(got, want) {
+		t.Errorf("SyncDir dry run returned: %v, want: %v", got, want)
+	}
+	if DirExists(dst) {
+		t.Errorf("SyncDir dry run created the destination")
+	}
+
+	opts.DryRun = false
+	results, err = SyncDir(src, dst, opts)
+	if err != nil {
+		t.Errorf("SyncDir failed with error: %v", err)
+	}
+	if got := syncPlan(results); !reflect.DeepEqual(got, want) {
+		t.Errorf("SyncDir returned: %v, want: %v", got, want)
+	}
+	if text, _ := ReadFile(filepath.Join(dst, "sub", "b.txt")); text != "sub/b.txt" {
+		t.Errorf("SyncDir did not copy file contents, got: %s", text)
+	}
+
+	// Unchanged files are not copied.
+	results, err = SyncDir(src, dst, opts)
+	if err != nil || len(results) != 0 {
+		t.Errorf("SyncDir of unchanged tree returned: %v, %v", syncPlan(results), err)
+	}
+
+	// Changed and extraneous files.
+	if err := WriteFile(filepath.Join(src, "a.txt"), "changed"); err != nil {
+		t.Errorf("WriteFile failed with error: %v", err)
+	}
+	for _, name := range []string{"old.txt", "old/d.txt", "sub/keep.tmp", "kept/e.tmp"} {
+		if err := WritePath(filepath.Join(dst, name), name); err != nil {
+			t.Errorf("WritePath failed with error: %v", err)
+		}
+	}
+	results, err = SyncDir(src, dst, opts)
+	if err != nil {
+		t.Errorf("SyncDir failed with error: %v", err)
+	}
+	want = []string{"delete old.txt", "delete old/d.txt", "delete old/", "update a.txt"}
+	if got := syncPlan(results); !reflect.DeepEqual(got, want) {
+		t.Errorf("SyncDir returned: %v, want: %v", got, want)
+	}
+	want = []string{"a.txt", "kept/", "kept/e.tmp", "sub/", "sub/b.txt", "sub/keep.tmp"}
+	if got := treeFiles(t, dst); !reflect.DeepEqual(got, want) {
+		t.Errorf("SyncDir destination: %v, want: %v", got, want)
+	}
+}
+
+func TestSyncDirChecksum(t *testing.T) {
+	tempDir := t.TempDir()
+	src := filepath.Join(tempDir, "src")
+	dst := filepath.Join(tempDir, "dst")
+	if err := WritePath(filepath.Join(src, "a.txt"), "AAA"); err != nil {
+		t.Errorf("WritePath failed with error: %v", err)
+	}
+	if _, err := SyncDir(src, dst, SyncOptions{}); err != nil {
+		t.Errorf("SyncDir failed with error: %v", err)
+	}
+
+	// Same size and modification time but different contents.
+	if err := WriteFile(filepath.Join(dst, "a.txt"), "BBB"); err != nil {
+		t.Errorf("WriteFile failed with error: %v", err)
+	}
+	modTime := FileModTime(filepath.Join(src, "a.txt"))
+	if err := os.Chtimes(filepath.Join(dst, "a.txt"), time.Time{}, modTime); err != nil {
+		t.Errorf("Chtimes failed with error: %v", err)
+	}
+	results, err := SyncDir(src, dst, SyncOptions{})
+	if err != nil || len(results) != 0 {
+		t.Errorf("SyncDir without checksums returned: %v, %v", syncPlan(results), err)
+	}
+	results, err = SyncDir(src, dst, SyncOptions{Checksum: true})
+	want := []string{"update a.txt"}
+	if got := syncPlan(results); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("SyncDir with checksums returned: %v, %v, want: %v", got, err, want)
+	}
+	if text, _ := ReadFile(filepath.Join(dst, "a.txt")); text != "AAA" {
+		t.Errorf("SyncDir did not update file contents, got: %s", text)
+	}
+}
+
+func TestSyncDirReadOnly(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("read-only files cannot be replaced on Windows")
+	}
+	if os.Geteuid() == 0 {
+		t.Skip("file permissions are not enforced for root")
+	}
+	tempDir := t.TempDir()
+	src := filepath.Join(tempDir, "src")
+	dst := filepath.Join(tempDir, "dst")
+	name := filepath.Join(src, "a")
+	for i, text := range []string{"a", "aa"} {
+		if err := WritePathOptions(name, text, WriteOptions{Atomic: true, Mode: 0444}); err != nil {
+			t.Fatalf("WritePathOptions failed with error: %v", err)
+		}
+		results, err := SyncDir(src, dst, SyncOptions{})
+		if err != nil {
+			t.Fatalf("SyncDir failed with error: %v", err)
+		}
+		want := []string{"create ./", "create a"}
+		if i > 0 {
+			want = []string{"update a"}
+		}
+		if got := syncPlan(results); !reflect.DeepEqual(got, want) {
+			t.Errorf("SyncDir returned: %v, want: %v", got, want)
+		}
+		if got, _ := ReadFile(filepath.Join(dst, "a")); got != text {
+			t.Errorf("SyncDir did not copy file contents, got: %s, want: %s", got, text)
+		}
+		if mode := fileMode(t, filepath.Join(dst, "a")); mode != 0444 {
+			t.Errorf("SyncDir did not copy mode, got: %v, want: %v", mode, os.FileMode(0444))
+		}
+	}
+}
+
+func TestSyncDirErrors(t *testing.T) {
+	tempDir := t.TempDir()
+	src := filepath.Join(tempDir, "src")
+	dst := filepath.Join(tempDir, "dst")
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := WritePath(filepath.Join(src, name), name); err != nil {
+			t.Errorf("WritePath failed with error: %v", err)
+		}
+	}
+	// A destination directory in place of a source file cannot be replaced without Delete.
+	if err := os.MkdirAll(filepath.Join(dst, "a.txt", "x"), 0775); err != nil {
+		t.Errorf("MkdirAll failed with error: %v", err)
+	}
+	results, err := SyncDir(src, dst, SyncOptions{})
+	if err == nil {
+		t.Errorf("SyncDir did not fail")
+	}
+	if len(results) != 2 || results[0].Err == nil || results[1].Err != nil {
+		t.Errorf("SyncDir returned: %v", syncPlan(results))
+	}
+	results, err = SyncDir(src, dst, SyncOptions{Delete: true})
+	want := []string{"delete a.txt/x/", "delete a.txt/", "create a.txt"}
+	if got := syncPlan(results); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("SyncDir returned: %v, %v, want: %v", got, err, want)
+	}
+}
@@ -0,0 +1,212 @@
+package fsx
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// WalkOptions configures Walk.
+type WalkOptions struct {
+	IgnoreFiles    []string // Names of .gitignore style ignore files e.g. ".gitignore".
+	MaxDepth       int      // Maximum depth below the root that is walked, zero is unlimited.
+	FollowSymlinks bool     // Walk symbolic links to directories.
+}
+
+// ignoreRule is a pattern read from an ignore file.
+type ignoreRule struct {
+	base    string // Slash separated ignore file directory relative to the walk root ("." for the root).
+	glob    globPattern
+	negate  bool // The pattern re-includes matching paths.
+	dirOnly bool // The pattern only matches directories.
+}
+
+// Walk walks the directory tree rooted at root calling fn for each file and directory, including root, in lexical
+// order. It is like filepath.WalkDir, fn has the same semantics, with these options:
+//
+//   - Files and directories matched by the patterns in the opts.IgnoreFiles ignore files are skipped, ignored
+//     directories are not walked. Ignore files use .gitignore syntax: blank lines and lines starting with "#" are
+//     skipped, "!" negates a pattern, a trailing "/" only matches directories, patterns containing a non-trailing "/"
+//     are relative to the ignore file's directory, other patterns match names at any depth below it. Patterns use
+//     Match syntax. Ignore files in subdirectories take precedence over those in parent directories.
+//   - Entries more than opts.MaxDepth levels below root are skipped (the entries of root are at depth 1).
+//   - If opts.FollowSymlinks is set then symbolic links to directories are walked, fn is called with the link path
+//     and an entry describing the linked directory. Links that lead back to a directory that is being walked are
+//     not followed, so walks always terminate.
+func Walk(root string, opts WalkOptions, fn fs.WalkDirFunc) error {
+	info, err := os.Lstat(root)
+	if err == nil && opts.FollowSymlinks && info.Mode()&os.ModeSymlink != 0 {
+		info, err = os.Stat(root)
+	}
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		w := walker{opts: opts, fn: fn}
+		err = w.walk(root, ".", fs.FileInfoToDirEntry(info), info, nil, 0)
+	}
+	if errors.Is(err, filepath.SkipDir) || errors.Is(err, filepath.SkipAll) {
+		return nil
+	}
+	return err
+}
+
+type walker struct {
+	opts      WalkOptions
+	fn        fs.WalkDirFunc
+	ancestors []os.FileInfo // The directories being walked, used to detect symbolic link loops.
+}
+
+// walk walks file p, whose slash separated path relative to the root is rel, at depth below the root.
+func (w *walker) walk(p, rel string, d fs.DirEntry, info os.FileInfo, rules []ignoreRule, depth int) error {
+	if err := w.fn(p, d, nil); err != nil || !d.IsDir() {
+		if errors.Is(err, filepath.SkipDir) && d.IsDir() {
+			return nil
+		}
+		return err
+	}
+	if w.opts.MaxDepth > 0 && depth >= w.opts.MaxDepth {
+		return nil
+	}
+	if info == nil {
+		var err error
+		if info, err = d.Info(); err != nil {
+			return w.dirError(p, d, err)
+		}
+	}
+	w.ancestors = append(w.ancestors, info)
+	defer func() { w.ancestors = w.ancestors[:len(w.ancestors)-1] }()
+	rules, err := w.readIgnoreFiles(p, rel, rules)
+	if err != nil {
+		return w.dirError(p, d, err)
+	}
+	entries, err := os.ReadDir(p)
+	if err != nil {
+		// As with filepath.WalkDir, the entries that were read are walked if fn returns nil.
+		if err := w.dirError(p, d, err); err != nil || len(entries) == 0 {
+			return err
+		}
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		childRel := path.Join(rel, name)
+		child := filepath.Join(p, name)
+		var childInfo os.FileInfo
+		if w.opts.FollowSymlinks && entry.Type()&os.ModeSymlink != 0 {
+			if target, err := os.Stat(child); err == nil && target.IsDir() && !w.isAncestor(target) {
+				childInfo = target
+				entry = fs.FileInfoToDirEntry(target)
+			}
+		}
+		if ignored(rules, childRel, entry.IsDir()) {
+			continue
+		}
+		if err := w.walk(child, childRel, entry, childInfo, rules, depth+1); err != nil {
+			if errors.Is(err, filepath.SkipDir) {
+				return nil // Skip the remaining entries in this directory.
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// dirError calls fn with an error reading directory p, SkipDir skips the directory.
+func (w *walker) dirError(p string, d fs.DirEntry, err error) error {
+	if err := w.fn(p, d, err); !errors.Is(err, filepath.SkipDir) {
+		return err
+	}
+	return nil
+}
+
+// isAncestor returns true if directory info is being walked.
+func (w *walker) isAncestor(info os.FileInfo) bool {
+	for _, a := range w.ancestors {
+		if os.SameFile(a, info) {
+			return true
+		}
+	}
+	return false
+}
+
+// readIgnoreFiles appends the rules from the ignore files in directory dir to rules.
+func (w *walker) readIgnoreFiles(dir, rel string, rules []ignoreRule) ([]ignoreRule, error) {
+	for _, name := range w.opts.IgnoreFiles {
+		f, err := os.Open(filepath.Join(dir, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		// Copy so sibling directories do not share appended rules.
+		rules = rules[:len(rules):len(rules)]
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			r, ok, err := parseIgnoreRule(rel, scanner.Text())
+			if err != nil {
+				f.Close()
+				return nil, &os.PathError{Op: "parse", Path: f.Name(), Err: err}
+			}
+			if ok {
+				rules = append(rules, r)
+			}
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return rules, nil
+}
+
+// parseIgnoreRule parses an ignore file line, ok is false if the line is blank or a comment.
+func parseIgnoreRule(base, line string) (r ignoreRule, ok bool, err error) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return r, false, nil
+	}
+	r.base = base
+	if strings.HasPrefix(line, "!") {
+		r.negate = true
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		r.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+	if strings.HasPrefix(line, "/") {
+		line = line[1:]
+	} else if !strings.Contains(line, "/") {
+		line = "**/" + line
+	}
+	if r.glob, err = compileGlob(line); err != nil {
+		return r, false, err
+	}
+	return r, true, nil
+}
+
+// ignored returns true if the last rule that matches slash separated path rel ignores it.
+func ignored(rules []ignoreRule, rel string, isDir bool) bool {
+	result := false
+	for _, r := range rules {
+		if r.dirOnly && !isDir {
+			continue
+		}
+		sub := rel
+		if r.base != "." {
+			var ok bool
+			if sub, ok = strings.CutPrefix(rel, r.base+"/"); !ok {
+				continue
+			}
+		}
+		if r.glob.match(sub) {
+			result = !r.negate
+		}
+	}
+	return result
+}
@@ -0,0 +1,118 @@
+package fsx
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+// walkPaths returns the slash separated relative paths walked by Walk, directory paths end with a slash.
+func walkPaths(t *testing.T, root string, opts WalkOptions) []string {
+	t.Helper()
+	var result []string
+	err := Walk(root, opts, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, p)
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			rel += "/"
+		}
+		result = append(result, rel)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Walk failed with error: %v", err)
+	}
+	return result
+}
+
+func TestWalk(t *testing.T) {
+	tempDir := t.TempDir()
+	files := map[string]string{
+		".gitignore":       "# Comment\n\n*.log\nbuild/\n/tmp\n!keep.log\n",
+		"a.txt":            "",
+		"debug.log":        "",
+		"keep.log":         "",
+		"build/out":        "",
+		"tmp/x":            "",
+		"src/tmp/y":        "",
+		"src/build":        "", // A file, not a build directory.
+		"src/trace.log":    "",
+		"src/.gitignore":   "*.txt\n!b.txt\n/gen/\n",
+		"src/a.txt":        "",
+		"src/b.txt":        "",
+		"src/gen/g.go":     "",
+		"src/sub/gen/h.go": "",
+	}
+	for name, text := range files {
+		if err := WritePath(filepath.Join(tempDir, filepath.FromSlash(name)), text); err != nil {
+			t.Errorf("WritePath failed with error: %v", err)
+		}
+	}
+
+	got := walkPaths(t, tempDir, WalkOptions{IgnoreFiles: []string{".gitignore"}})
+	want := []string{"./", ".gitignore", "a.txt", "keep.log", "src/", "src/.gitignore", "src/b.txt", "src/build",
+		"src/sub/", "src/sub/gen/", "src/sub/gen/h.go", "src/tmp/", "src/tmp/y"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Walk returned: %v\nwant: %v", got, want)
+	}
+
+	got = walkPaths(t, tempDir, WalkOptions{MaxDepth: 1, IgnoreFiles: []string{".gitignore"}})
+	want = []string{"./", ".gitignore", "a.txt", "keep.log", "src/"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Walk with MaxDepth returned: %v\nwant: %v", got, want)
+	}
+
+	// SkipDir skips a directory, SkipAll stops the walk.
+	var walked []string
+	err := Walk(tempDir, WalkOptions{}, func(p string, d fs.DirEntry, err error) error {
+		rel, _ := filepath.Rel(tempDir, p)
+		walked = append(walked, filepath.ToSlash(rel))
+		switch rel {
+		case "build":
+			return filepath.SkipDir
+		case "keep.log":
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("Walk failed with error: %v", err)
+	}
+	want = []string{".", ".gitignore", "a.txt", "build", "debug.log", "keep.log"}
+	if !reflect.DeepEqual(walked, want) {
+		t.Errorf("Walk returned: %v\nwant: %v", walked, want)
+	}
+}
+
+func TestWalkSymlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symbolic links require privileges on Windows")
+	}
+	tempDir := t.TempDir()
+	if err := WritePath(filepath.Join(tempDir, "a", "x"), ""); err != nil {
+		t.Errorf("WritePath failed with error: %v", err)
+	}
+	if err := os.Symlink("..", filepath.Join(tempDir, "a", "loop")); err != nil {
+		t.Errorf("Symlink failed with error: %v", err)
+	}
+	if err := os.Symlink("a", filepath.Join(tempDir, "b")); err != nil {
+		t.Errorf("Symlink failed with error: %v", err)
+	}
+
+	got := walkPaths(t, tempDir, WalkOptions{})
+	want := []string{"./", "a/", "a/loop", "a/x", "b"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Walk returned: %v\nwant: %v", got, want)
+	}
+	got = walkPaths(t, tempDir, WalkOptions{FollowSymlinks: true})
+	want = []string{"./", "a/", "a/loop", "a/x", "b/", "b/loop", "b/x"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Walk following symlinks returned: %v\nwant: %v", got, want)
+	}
+}
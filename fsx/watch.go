@@ -0,0 +1,290 @@
+package fsx
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// DefaultDebounce is the time Watch waits for changes to stop when WatchOptions.Debounce is zero.
+const DefaultDebounce = 100 * time.Millisecond
+
+// DefaultPollInterval is the polling interval when WatchOptions.PollInterval is zero.
+const DefaultPollInterval = time.Second
+
+// Op is a file change operation.
+type Op int
+
+const (
+	Create Op = iota + 1
+	Modify
+	Delete
+	Rename // The file was renamed or moved, the new path is reported as a Create.
+)
+
+func (op Op) String() string {
+	switch op {
+	case Create:
+		return "create"
+	case Modify:
+		return "modify"
+	case Delete:
+		return "delete"
+	case Rename:
+		return "rename"
+	default:
+		return "unknown"
+	}
+}
+
+// Event is a file or directory change reported by Watch.
+type Event struct {
+	Path string // The watched path joined with the path of the changed file relative to it.
+	Op   Op
+}
+
+func (e Event) String() string {
+	return e.Op.String() + " " + e.Path
+}
+
+// WatchOptions configures Watch.
+type WatchOptions struct {
+	Debounce     time.Duration // Time without changes before a batch is delivered (defaults to DefaultDebounce).
+	PollInterval time.Duration // Polling interval (defaults to DefaultPollInterval).
+	Poll         bool          // Poll for changes even if native file system notifications are available.
+	Include      []string      // Only report files and directories matching one of these patterns (default all).
+	Exclude      []string      // Ignore files and directories matching any of these patterns.
+}
+
+// watchRoot is a path passed to Watch.
+type watchRoot struct {
+	path string
+	dir  bool
+}
+
+type watcher struct {
+	roots []watchRoot
+	opts  WatchOptions
+}
+
+// Watch watches files and directory trees and calls onChange with batches of changes until ctx is cancelled. Changes
+// are delivered once no further changes have occurred for opts.Debounce. The changes to each file within a batch are
+// coalesced into a single event (e.g. a file that is created and then modified is reported as created, a file that
+// is created and then deleted is not reported) and batches are sorted by path.
+//
+// On Linux changes are detected with inotify, otherwise, or if opts.Poll is set or inotify is unavailable, the
+// watched files are polled every opts.PollInterval and changes are detected by comparing modification times and
+// sizes. Polling cannot detect renames, they are reported as a Delete and a Create. Watched paths that are deleted
+// and then recreated may not be watched natively, use polling if this matters.
+//
+// Include and Exclude patterns use Match syntax and are matched against slash separated paths relative to the
+// watched directory (or, for watched files, the file name). Patterns that do not contain a slash are matched against
+// the file or directory name, changes inside excluded directories are not reported.
+//
+// Watch returns an error if a path does not exist, a pattern is malformed or watching fails, it returns nil when ctx
+// is cancelled. onChange is called from Watch's goroutine.
+func Watch(ctx context.Context, paths []string, opts WatchOptions, onChange func(events []Event)) error {
+	if err := checkPatterns(opts.Include); err != nil {
+		return err
+	}
+	if err := checkPatterns(opts.Exclude); err != nil {
+		return err
+	}
+	w := &watcher{opts: opts}
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return err
+		}
+		w.roots = append(w.roots, watchRoot{path: filepath.Clean(p), dir: info.IsDir()})
+	}
+	debounce := opts.Debounce
+	if debounce <= 0 {
+		debounce = DefaultDebounce
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	events := make(chan Event, 256)
+	errc := make(chan error, 1)
+	err := errors.ErrUnsupported
+	if !opts.Poll {
+		err = w.notify(ctx, events, errc)
+	}
+	if err != nil {
+		w.poll(ctx, events)
+	}
+	pending := make(map[string]Op)
+	timer := time.NewTimer(debounce)
+	timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-errc:
+			return err
+		case e := <-events:
+			if w.selected(e.Path) {
+				coalesce(pending, e)
+				timer.Reset(debounce)
+			}
+		case <-timer.C:
+			if len(pending) == 0 {
+				continue
+			}
+			batch := make([]Event, 0, len(pending))
+			for p, op := range pending {
+				batch = append(batch, Event{Path: p, Op: op})
+			}
+			sort.Slice(batch, func(i, j int) bool { return batch[i].Path < batch[j].Path })
+			pending = make(map[string]Op)
+			onChange(batch)
+		}
+	}
+}
+
+// coalesce adds event e to the pending changes.
+func coalesce(pending map[string]Op, e Event) {
+	prev, ok := pending[e.Path]
+	switch {
+	case !ok:
+		pending[e.Path] = e.Op
+	case prev == Create && (e.Op == Delete || e.Op == Rename):
+		delete(pending, e.Path)
+	case prev == Create:
+		// Still a new file.
+	case (prev == Delete || prev == Rename) && e.Op == Create:
+		pending[e.Path] = Modify
+	default:
+		pending[e.Path] = e.Op
+	}
+}
+
+// selected returns true if changes to path p are reported.
+func (w *watcher) selected(p string) bool {
+	for _, r := range w.roots {
+		var rel string
+		switch {
+		case r.dir && p != r.path && PathIsInDir(p, r.path):
+			rel, _ = filepath.Rel(r.path, p)
+		case !r.dir && p == r.path:
+			rel = filepath.Base(p)
+		default:
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		if !w.excluded(rel) && (len(w.opts.Include) == 0 || matchAny(w.opts.Include, rel)) {
+			return true
+		}
+	}
+	return false
+}
+
+// excluded returns true if slash separated relative path rel, or one of its parent directories, matches an Exclude
+// pattern.
+func (w *watcher) excluded(rel string) bool {
+	for p := rel; p != "." && p != "/"; p = path.Dir(p) {
+		if matchAny(w.opts.Exclude, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// inDir returns the watched directory that contains path p, or an empty string if there isn't one.
+func (w *watcher) inDir(p string) string {
+	for _, r := range w.roots {
+		if r.dir && PathIsInDir(p, r.path) {
+			return r.path
+		}
+	}
+	return ""
+}
+
+// walkDir calls fn for each directory and file in watched directory root that is not in an excluded directory.
+func (w *watcher) walkDir(root, dir string, fn func(p string, info os.FileInfo)) {
+	Walk(dir, WalkOptions{}, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // Files can be deleted while they are walked.
+		}
+		if rel, err := filepath.Rel(root, p); err == nil && d.IsDir() && w.excluded(filepath.ToSlash(rel)) {
+			return filepath.SkipDir
+		}
+		if info, err := d.Info(); err == nil {
+			fn(p, info)
+		}
+		return nil
+	})
+}
+
+// fileState records the file attributes compared by polling.
+type fileState struct {
+	modTime time.Time
+	size    int64
+	dir     bool
+}
+
+// snapshot returns the state of the watched files.
+func (w *watcher) snapshot() map[string]fileState {
+	files := make(map[string]fileState)
+	for _, r := range w.roots {
+		if !r.dir {
+			if info, err := os.Stat(r.path); err == nil {
+				files[r.path] = fileState{modTime: info.ModTime(), size: info.Size(), dir: info.IsDir()}
+			}
+			continue
+		}
+		w.walkDir(r.path, r.path, func(p string, info os.FileInfo) {
+			if p != r.path {
+				files[p] = fileState{modTime: info.ModTime(), size: info.Size(), dir: info.IsDir()}
+			}
+		})
+	}
+	return files
+}
+
+// poll starts a goroutine that polls the watched files and sends changes to events until ctx is cancelled.
+func (w *watcher) poll(ctx context.Context, events chan<- Event) {
+	interval := w.opts.PollInterval
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	prev := w.snapshot()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			cur := w.snapshot()
+			var changes []Event
+			for p, s := range cur {
+				if ps, ok := prev[p]; !ok || ps.dir != s.dir {
+					changes = append(changes, Event{Path: p, Op: Create})
+				} else if !s.dir && (!s.modTime.Equal(ps.modTime) || s.size != ps.size) {
+					changes = append(changes, Event{Path: p, Op: Modify})
+				}
+			}
+			for p := range prev {
+				if _, ok := cur[p]; !ok {
+					changes = append(changes, Event{Path: p, Op: Delete})
+				}
+			}
+			prev = cur
+			for _, e := range changes {
+				select {
+				case events <- e:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,180 @@
+//go:build linux
+
+package fsx
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+const inotifyMask = syscall.IN_CREATE | syscall.IN_MODIFY | syscall.IN_ATTRIB | syscall.IN_DELETE |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_EXCL_UNLINK | syscall.IN_ONLYDIR
+
+// inotify watches directories with Linux inotify.
+type inotify struct {
+	w    *watcher
+	fd   int
+	dirs map[int]string // Watched directories keyed by watch descriptor.
+	wds  map[string]int // Watch descriptors keyed by directory.
+	file *os.File
+}
+
+// notify starts a goroutine that watches the watched paths with inotify and sends changes to events until ctx is
+// cancelled. Watched directory trees are watched recursively, watched files are watched by watching their
+// directories. If reading events fails the error is sent to errc.
+func (w *watcher) notify(ctx context.Context, events chan<- Event, errc chan<- error) error {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return os.NewSyscallError("inotify_init1", err)
+	}
+	n := &inotify{w: w, fd: fd, dirs: make(map[int]string), wds: make(map[string]int)}
+	for _, r := range w.roots {
+		if r.dir {
+			_, err = n.addTree(r.path, r.path, false)
+		} else {
+			err = n.add(filepath.Dir(r.path))
+		}
+		if err != nil {
+			syscall.Close(fd)
+			return err
+		}
+	}
+	// The file is non-blocking so reads use the runtime poller and are interrupted when the file is closed.
+	n.file = os.NewFile(uintptr(fd), "inotify")
+	go func() {
+		<-ctx.Done()
+		n.file.Close()
+	}()
+	go n.read(ctx, events, errc)
+	return nil
+}
+
+// read reads inotify events and sends the resulting changes to events until ctx is cancelled.
+func (n *inotify) read(ctx context.Context, events chan<- Event, errc chan<- error) {
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		count, err := n.file.Read(buf)
+		if err != nil {
+			if ctx.Err() == nil {
+				errc <- err
+			}
+			return
+		}
+		var changes []Event
+		for off := 0; off+syscall.SizeofInotifyEvent <= count; {
+			raw := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[off]))
+			name := buf[off+syscall.SizeofInotifyEvent : off+syscall.SizeofInotifyEvent+int(raw.Len)]
+			off += syscall.SizeofInotifyEvent + int(raw.Len)
+			if raw.Mask&syscall.IN_Q_OVERFLOW != 0 {
+				errc <- errors.New("fsx: inotify event queue overflow")
+				return
+			}
+			changes, err = n.handle(changes, int(raw.Wd), raw.Mask, string(bytes.TrimRight(name, "\x00")))
+			if err != nil {
+				errc <- err
+				return
+			}
+		}
+		for _, e := range changes {
+			select {
+			case events <- e:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// handle appends the changes described by an inotify event for file name in the directory watched by watch
+// descriptor wd to changes.
+func (n *inotify) handle(changes []Event, wd int, mask uint32, name string) ([]Event, error) {
+	dir, ok := n.dirs[wd]
+	if !ok {
+		return changes, nil
+	}
+	if mask&syscall.IN_IGNORED != 0 {
+		// The directory was deleted or is no longer watched.
+		delete(n.dirs, wd)
+		if n.wds[dir] == wd {
+			delete(n.wds, dir)
+		}
+		return changes, nil
+	}
+	if name == "" {
+		return changes, nil
+	}
+	p := filepath.Join(dir, name)
+	isDir := mask&syscall.IN_ISDIR != 0
+	switch {
+	case mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0:
+		changes = append(changes, Event{Path: p, Op: Create})
+		if root := n.w.inDir(p); isDir && root != "" {
+			// Files can be created before the directory is watched so its contents are reported as created.
+			created, err := n.addTree(root, p, true)
+			if err != nil {
+				return nil, err
+			}
+			changes = append(changes, created...)
+		}
+	case mask&syscall.IN_MOVED_FROM != 0:
+		changes = append(changes, Event{Path: p, Op: Rename})
+		if isDir {
+			n.removeTree(p)
+		}
+	case mask&syscall.IN_DELETE != 0:
+		changes = append(changes, Event{Path: p, Op: Delete})
+	case mask&(syscall.IN_MODIFY|syscall.IN_ATTRIB) != 0 && !isDir:
+		changes = append(changes, Event{Path: p, Op: Modify})
+	}
+	return changes, nil
+}
+
+// add watches directory dir.
+func (n *inotify) add(dir string) error {
+	if _, ok := n.wds[dir]; ok {
+		return nil
+	}
+	wd, err := syscall.InotifyAddWatch(n.fd, dir, inotifyMask)
+	if err != nil {
+		return &os.PathError{Op: "inotify_add_watch", Path: dir, Err: err}
+	}
+	n.dirs[wd] = dir
+	n.wds[dir] = wd
+	return nil
+}
+
+// addTree watches directory dir and the directories below it that are not excluded, dir is in watched directory
+// root. If report is set the files and directories below dir are returned as created.
+func (n *inotify) addTree(root, dir string, report bool) ([]Event, error) {
+	var created []Event
+	var err error
+	n.w.walkDir(root, dir, func(p string, info os.FileInfo) {
+		if info.IsDir() && err == nil {
+			err = n.add(p)
+			if errors.Is(err, fs.ErrNotExist) || errors.Is(err, syscall.ENOTDIR) {
+				err = nil // Deleted or replaced while it was being walked.
+			}
+		}
+		if report && p != dir {
+			created = append(created, Event{Path: p, Op: Create})
+		}
+	})
+	return created, err
+}
+
+// removeTree stops watching directory dir and the directories below it.
+func (n *inotify) removeTree(dir string) {
+	for p, wd := range n.wds {
+		if PathIsInDir(p, dir) {
+			syscall.InotifyRmWatch(n.fd, uint32(wd))
+			delete(n.wds, p)
+			delete(n.dirs, wd)
+		}
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package fsx
+
+import (
+	"context"
+	"errors"
+)
+
+// notify returns errors.ErrUnsupported, native file system notifications are not supported on this platform.
+func (w *watcher) notify(ctx context.Context, events chan<- Event, errc chan<- error) error {
+	return errors.ErrUnsupported
+}
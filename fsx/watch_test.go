@@ -0,0 +1,134 @@
+package fsx
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// watchChanges starts watching paths and returns a function that waits for the changes relative to dir, batches are
+// coalesced until they match want.
+func watchChanges(t *testing.T, dir string, paths []string, opts WatchOptions) func(want map[string]Op) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	batches := make(chan []Event, 100)
+	done := make(chan error)
+	go func() {
+		done <- Watch(ctx, paths, opts, func(events []Event) { batches <- events })
+	}()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Watch failed with error: %v", err)
+		}
+	})
+	time.Sleep(100 * time.Millisecond) // Wait for the watch to start.
+	return func(want map[string]Op) {
+		t.Helper()
+		got := make(map[string]Op)
+		timeout := time.After(5 * time.Second)
+		for !reflect.DeepEqual(got, want) {
+			select {
+			case events := <-batches:
+				for _, e := range events {
+					rel, _ := filepath.Rel(dir, e.Path)
+					coalesce(got, Event{Path: filepath.ToSlash(rel), Op: e.Op})
+				}
+			case <-timeout:
+				t.Fatalf("Watch reported: %v, want: %v", got, want)
+			}
+		}
+	}
+}
+
+func testWatch(t *testing.T, poll bool) {
+	tempDir := t.TempDir()
+	opts := WatchOptions{Debounce: 50 * time.Millisecond, PollInterval: 20 * time.Millisecond, Poll: poll,
+		Exclude: []string{"*.tmp"}}
+	wait := watchChanges(t, tempDir, []string{tempDir}, opts)
+	write := func(name, text string) {
+		t.Helper()
+		if err := WritePath(filepath.Join(tempDir, name), text); err != nil {
+			t.Fatalf("WritePath failed with error: %v", err)
+		}
+	}
+
+	write("a.txt", "a")
+	wait(map[string]Op{"a.txt": Create})
+
+	write("a.txt", "aa")
+	wait(map[string]Op{"a.txt": Modify})
+
+	write("sub/b.txt", "b")
+	wait(map[string]Op{"sub": Create, "sub/b.txt": Create})
+
+	if err := os.Rename(filepath.Join(tempDir, "a.txt"), filepath.Join(tempDir, "c.txt")); err != nil {
+		t.Fatalf("Rename failed with error: %v", err)
+	}
+	if poll {
+		wait(map[string]Op{"a.txt": Delete, "c.txt": Create})
+	} else {
+		wait(map[string]Op{"a.txt": Rename, "c.txt": Create})
+	}
+
+	if err := os.Remove(filepath.Join(tempDir, "sub", "b.txt")); err != nil {
+		t.Fatalf("Remove failed with error: %v", err)
+	}
+	wait(map[string]Op{"sub/b.txt": Delete})
+
+	// Excluded files are not reported, files created and deleted within a batch are not reported.
+	write("x.tmp", "x")
+	write("sub/e.txt", "e")
+	if err := os.Remove(filepath.Join(tempDir, "sub", "e.txt")); err != nil {
+		t.Fatalf("Remove failed with error: %v", err)
+	}
+	write("d.txt", "d")
+	wait(map[string]Op{"d.txt": Create})
+}
+
+func TestWatch(t *testing.T) {
+	t.Run("poll", func(t *testing.T) { testWatch(t, true) })
+	if runtime.GOOS == "linux" {
+		t.Run("inotify", func(t *testing.T) { testWatch(t, false) })
+	}
+}
+
+func TestWatchFile(t *testing.T) {
+	tempDir := t.TempDir()
+	fileName := filepath.Join(tempDir, "a.txt")
+	if err := WriteFile(fileName, "a"); err != nil {
+		t.Fatalf("WriteFile failed with error: %v", err)
+	}
+	opts := WatchOptions{Debounce: 50 * time.Millisecond, PollInterval: 20 * time.Millisecond}
+	wait := watchChanges(t, tempDir, []string{fileName}, opts)
+
+	// Changes to other files in the directory are not reported.
+	if err := WriteFile(filepath.Join(tempDir, "b.txt"), "b"); err != nil {
+		t.Fatalf("WriteFile failed with error: %v", err)
+	}
+	if err := WriteFile(fileName, "aa"); err != nil {
+		t.Fatalf("WriteFile failed with error: %v", err)
+	}
+	wait(map[string]Op{"a.txt": Modify})
+}
+
+func TestWatchErrors(t *testing.T) {
+	tempDir := t.TempDir()
+	ctx := context.Background()
+	onChange := func([]Event) {}
+	if err := Watch(ctx, []string{filepath.Join(tempDir, "missing")}, WatchOptions{}, onChange); !os.IsNotExist(err) {
+		t.Errorf("Watch of missing path returned: %v", err)
+	}
+	if err := Watch(ctx, []string{tempDir}, WatchOptions{Include: []string{"["}}, onChange); err == nil {
+		t.Errorf("Watch with malformed pattern did not return an error")
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := Watch(ctx, []string{tempDir}, WatchOptions{}, onChange); err != nil {
+		t.Errorf("Watch with cancelled context returned: %v", err)
+	}
+}
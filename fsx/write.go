@@ -0,0 +1,154 @@
+package fsx
+
+import (
+	"io"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+)
+
+// WriteOptions configures the write functions and, via CopyOptions, CopyFileOptions and CopyDir.
+type WriteOptions struct {
+	Atomic        bool        // Write a temporary file and rename it over the destination (see AtomicWriteFile).
+	Mode          os.FileMode // File permissions, if zero new files are created like WriteFile and existing files keep their mode.
+	PreserveMode  bool        // Existing files keep their mode, Mode only applies to new files.
+	PreserveOwner bool        // Atomically replaced files keep their owner and group (no-op on Windows).
+}
+
+// AtomicWriteFile writes text to file name so that readers see either the previous or the new file contents, never
+// a partially written file. The text is written to a temporary file in the same directory, synced to disk and then
+// renamed to name. The mode of an existing file is preserved, new files are created with mode 0644 less the umask.
+func AtomicWriteFile(name string, text string) error {
+	return WriteFileOptions(name, text, WriteOptions{Atomic: true})
+}
+
+// WriteFileOptions writes text to file name using options opts.
+func WriteFileOptions(name string, text string, opts WriteOptions) error {
+	return WriteFileFunc(name, opts, func(f *os.File) error {
+		_, err := io.WriteString(f, text)
+		return err
+	})
+}
+
+// WritePathOptions writes file using options opts and creates any missing path directories.
+func WritePathOptions(path string, text string, opts WriteOptions) error {
+	if err := MkMissingDir(filepath.Dir(path)); err != nil {
+		return err
+	}
+	return WriteFileOptions(path, text, opts)
+}
+
+// WriteFileFunc creates or replaces file name using options opts, write is called to write the file contents to f. If
+// write returns an error it is returned and, for atomic writes, the file is left unchanged.
+func WriteFileFunc(name string, opts WriteOptions, write func(f *os.File) error) error {
+	// Atomic writes replace the target of a symbolic link, not the link.
+	if target, err := filepath.EvalSymlinks(name); err == nil {
+		name = target
+	}
+	info, err := os.Stat(name)
+	exists := err == nil
+	mode := opts.Mode
+	if exists && (mode == 0 || opts.PreserveMode) {
+		mode = info.Mode().Perm()
+	}
+	if !opts.Atomic {
+		return writeInPlace(name, mode, opts.Mode != 0, write)
+	}
+	var chown func(f *os.File) error
+	if exists && opts.PreserveOwner {
+		chown = func(f *os.File) error { return chownLike(f, info) }
+	}
+	return writeAtomic(name, mode, chown, write)
+}
+
+// writeInPlace truncates and writes file name, the file is created with mode if it does not exist. If chmod is true
+// the file mode is set to mode.
+func writeInPlace(name string, mode os.FileMode, chmod bool, write func(f *os.File) error) error {
+	if mode == 0 {
+		mode = 0644
+	}
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	if chmod {
+		if err := f.Chmod(mode); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// writeAtomic writes a temporary file in the same directory as name, syncs it to disk, renames it to name and then
+// syncs the directory so the rename is durable. The temporary file is removed if the write fails. If mode is zero the
+// file is created with mode 0644 less the umask.
+func writeAtomic(name string, mode os.FileMode, chown func(f *os.File) error, write func(f *os.File) error) (err error) {
+	dir := filepath.Dir(name)
+	f, err := createTemp(dir, filepath.Base(name)+".tmp-", 0644)
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(tmp)
+		}
+	}()
+	if err = write(f); err != nil {
+		return err
+	}
+	if mode != 0 {
+		if err = f.Chmod(mode); err != nil {
+			return err
+		}
+	}
+	if chown != nil {
+		if err = chown(f); err != nil {
+			return err
+		}
+	}
+	if err = f.Sync(); err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, name); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// createTemp creates a new file in directory dir, named prefix followed by a random number, with mode perm less the
+// umask (os.CreateTemp always uses mode 0600).
+func createTemp(dir, prefix string, perm os.FileMode) (*os.File, error) {
+	for try := 0; ; try++ {
+		name := filepath.Join(dir, prefix+strconv.FormatUint(uint64(rand.Uint32()), 10))
+		f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, perm)
+		if os.IsExist(err) && try < 10000 {
+			continue
+		}
+		return f, err
+	}
+}
+
+// syncDir flushes directory dir to disk. Directories cannot be synced on Windows so it is a no-op there.
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,153 @@
+package fsx
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func fileMode(t *testing.T, name string) os.FileMode {
+	t.Helper()
+	info, err := os.Stat(name)
+	if err != nil {
+		t.Fatalf("Stat failed with error: %v", err)
+	}
+	return info.Mode().Perm()
+}
+
+func TestAtomicWriteFile(t *testing.T) {
+	tempDir := t.TempDir()
+	fileName := filepath.Join(tempDir, "test_atomic_write_file")
+
+	err := AtomicWriteFile(fileName, "Test")
+	if err != nil {
+		t.Errorf("AtomicWriteFile failed with error: %v", err)
+	}
+	if mode := fileMode(t, fileName); mode != 0644 {
+		t.Errorf("AtomicWriteFile created file with mode %v, want: %v", mode, os.FileMode(0644))
+	}
+
+	if err := os.Chmod(fileName, 0600); err != nil {
+		t.Errorf("Chmod failed with error: %v", err)
+	}
+	err = AtomicWriteFile(fileName, "Test 2")
+	if err != nil {
+		t.Errorf("AtomicWriteFile failed with error: %v", err)
+	}
+	if mode := fileMode(t, fileName); mode != 0600 {
+		t.Errorf("AtomicWriteFile did not preserve mode, got: %v, want: %v", mode, os.FileMode(0600))
+	}
+	if text, _ := ReadFile(fileName); text != "Test 2" {
+		t.Errorf("AtomicWriteFile did not write the text, got: %s, want: %s", text, "Test 2")
+	}
+	if n := DirCount(tempDir); n != 1 {
+		t.Errorf("AtomicWriteFile left temporary files, got %d files, want: 1", n)
+	}
+
+	// A missing directory fails and leaves no temporary file.
+	err = AtomicWriteFile(filepath.Join(tempDir, "missing", "file"), "Test")
+	if err == nil {
+		t.Errorf("AtomicWriteFile did not fail with missing directory")
+	}
+}
+
+func TestAtomicWriteFileSymlink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symbolic links require privileges on Windows")
+	}
+	tempDir := t.TempDir()
+	target := filepath.Join(tempDir, "target")
+	link := filepath.Join(tempDir, "link")
+	if err := WriteFile(target, "Test"); err != nil {
+		t.Errorf("WriteFile failed with error: %v", err)
+	}
+	if err := os.Symlink(target, link); err != nil {
+		t.Errorf("Symlink failed with error: %v", err)
+	}
+	if err := AtomicWriteFile(link, "Test 2"); err != nil {
+		t.Errorf("AtomicWriteFile failed with error: %v", err)
+	}
+	if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("AtomicWriteFile replaced the symbolic link")
+	}
+	if text, _ := ReadFile(target); text != "Test 2" {
+		t.Errorf("AtomicWriteFile did not write the link target, got: %s, want: %s", text, "Test 2")
+	}
+}
+
+func TestWriteFileOptions(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, atomic := range []bool{false, true} {
+		fileName := filepath.Join(tempDir, "test_write_file_options")
+		os.Remove(fileName)
+
+		// Mode sets the mode of new and existing files.
+		err := WriteFileOptions(fileName, "Test", WriteOptions{Atomic: atomic, Mode: 0600})
+		if err != nil {
+			t.Errorf("WriteFileOptions failed with error: %v", err)
+		}
+		if mode := fileMode(t, fileName); mode != 0600 {
+			t.Errorf("WriteFileOptions (atomic %v) created file with mode %v, want: %v", atomic, mode, os.FileMode(0600))
+		}
+		err = WriteFileOptions(fileName, "Test", WriteOptions{Atomic: atomic, Mode: 0640})
+		if err != nil {
+			t.Errorf("WriteFileOptions failed with error: %v", err)
+		}
+		if mode := fileMode(t, fileName); mode != 0640 {
+			t.Errorf("WriteFileOptions (atomic %v) set mode %v, want: %v", atomic, mode, os.FileMode(0640))
+		}
+
+		// PreserveMode keeps the mode of existing files.
+		err = WriteFileOptions(fileName, "Test 2", WriteOptions{Atomic: atomic, Mode: 0600, PreserveMode: true, PreserveOwner: true})
+		if err != nil {
+			t.Errorf("WriteFileOptions failed with error: %v", err)
+		}
+		if mode := fileMode(t, fileName); mode != 0640 {
+			t.Errorf("WriteFileOptions (atomic %v) did not preserve mode, got: %v, want: %v", atomic, mode, os.FileMode(0640))
+		}
+		if text, _ := ReadFile(fileName); text != "Test 2" {
+			t.Errorf("WriteFileOptions did not write the text, got: %s, want: %s", text, "Test 2")
+		}
+	}
+}
+
+func TestWritePathOptions(t *testing.T) {
+	tempDir := t.TempDir()
+	fileName := filepath.Join(tempDir, "test_write_path", "test_write_path.txt")
+	err := WritePathOptions(fileName, "Test", WriteOptions{Atomic: true, Mode: 0600})
+	if err != nil {
+		t.Errorf("WritePathOptions failed with error: %v", err)
+	}
+	if mode := fileMode(t, fileName); mode != 0600 {
+		t.Errorf("WritePathOptions created file with mode %v, want: %v", mode, os.FileMode(0600))
+	}
+}
+
+func TestWriteFileFunc(t *testing.T) {
+	tempDir := t.TempDir()
+	fileName := filepath.Join(tempDir, "test_write_file_func")
+	err := WriteFileFunc(fileName, WriteOptions{Atomic: true}, func(f *os.File) error {
+		_, err := f.WriteString("Test")
+		return err
+	})
+	if err != nil {
+		t.Errorf("WriteFileFunc failed with error: %v", err)
+	}
+
+	// A failed atomic write leaves the file unchanged and removes the temporary file.
+	err = WriteFileFunc(fileName, WriteOptions{Atomic: true}, func(f *os.File) error {
+		f.WriteString("Te")
+		return errors.New("disk full")
+	})
+	if err == nil || err.Error() != "disk full" {
+		t.Errorf("WriteFileFunc returned error: %v, want: disk full", err)
+	}
+	if text, _ := ReadFile(fileName); text != "Test" {
+		t.Errorf("WriteFileFunc changed the file, got: %s, want: %s", text, "Test")
+	}
+	if n := DirCount(tempDir); n != 1 {
+		t.Errorf("WriteFileFunc left %d files, want: 1", n)
+	}
+}
@@ -0,0 +1,46 @@
+//go:build unix
+
+package fsx
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestWriteFileUmask(t *testing.T) {
+	old := syscall.Umask(077)
+	defer syscall.Umask(old)
+	tempDir := t.TempDir()
+
+	tests := []struct {
+		name string
+		opts WriteOptions
+		want os.FileMode
+	}{
+		{"atomic", WriteOptions{Atomic: true}, 0600},
+		{"in-place", WriteOptions{}, 0600},
+		{"atomic-mode", WriteOptions{Atomic: true, Mode: 0640}, 0640}, // An explicit mode is not masked.
+	}
+	for _, tt := range tests {
+		fileName := filepath.Join(tempDir, tt.name)
+		if err := WriteFileOptions(fileName, "Test", tt.opts); err != nil {
+			t.Errorf("WriteFileOptions failed with error: %v", err)
+		}
+		if mode := fileMode(t, fileName); mode != tt.want {
+			t.Errorf("%s: WriteFileOptions created file with mode %v, want: %v", tt.name, mode, tt.want)
+		}
+	}
+	fileName := filepath.Join(tempDir, "write-file")
+	if err := WriteFile(fileName, "Test"); err != nil {
+		t.Errorf("WriteFile failed with error: %v", err)
+	}
+	atomicName := filepath.Join(tempDir, "atomic-write-file")
+	if err := AtomicWriteFile(atomicName, "Test"); err != nil {
+		t.Errorf("AtomicWriteFile failed with error: %v", err)
+	}
+	if mode, want := fileMode(t, atomicName), fileMode(t, fileName); mode != want {
+		t.Errorf("AtomicWriteFile created file with mode %v, want: %v", mode, want)
+	}
+}
@@ -2,4 +2,7 @@ module github.com/srackham/go-utils
 
 go 1.23.7
 
-require golang.org/x/exp v0.0.0-20250408133849-7e4ce0ab07d0
+require (
+	golang.org/x/crypto v0.41.0
+	golang.org/x/exp v0.0.0-20250408133849-7e4ce0ab07d0
+)